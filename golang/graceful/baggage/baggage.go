@@ -0,0 +1,40 @@
+package baggage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+type fieldsKey struct{}
+
+// WithFields stores the configured members found on the request.
+func WithFields(ctx context.Context, fields map[string]string) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Fields returns the configured members found on the request, e.g.
+// tenant.id, for logging.
+func Fields(ctx context.Context) map[string]string {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]string)
+	return fields
+}
+
+// Member returns the value of a baggage member, whether or not it is one of
+// the configured members.
+func Member(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// WithMember sets a member which is sent on by the instrumented clients.
+func WithMember(ctx context.Context, key string, value string) (context.Context, error) {
+	member, err := baggage.NewMember(key, value)
+	if err != nil {
+		return ctx, err
+	}
+	b, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx, err
+	}
+	return baggage.ContextWithBaggage(ctx, b), nil
+}
@@ -0,0 +1,172 @@
+// Command traceview renders the spans written by the stdout and file
+// tracers as a tree per trace.
+//
+//	traceview [-trace id] [-attrs] [file ...]
+//
+// With no files the spans are read from stdin.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type spanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+type attribute struct {
+	Key   string
+	Value struct {
+		Type  string
+		Value interface{}
+	}
+}
+
+type span struct {
+	Name        string
+	SpanContext spanContext
+	Parent      spanContext
+	SpanKind    int
+	StartTime   time.Time
+	EndTime     time.Time
+	Attributes  []attribute
+	Status      struct {
+		Code        string
+		Description string
+	}
+
+	children []*span
+}
+
+var kinds = map[int]string{
+	1: "internal",
+	2: "server",
+	3: "client",
+	4: "producer",
+	5: "consumer",
+}
+
+func read(r io.Reader, traces map[string][]*span) error {
+	dec := json.NewDecoder(r)
+	for {
+		s := &span{}
+		if err := dec.Decode(s); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		traces[s.SpanContext.TraceID] = append(traces[s.SpanContext.TraceID], s)
+	}
+}
+
+// tree links the spans of a trace, spans whose parent was never written are
+// shown as roots.
+func tree(spans []*span) []*span {
+	byID := make(map[string]*span, len(spans))
+	for _, s := range spans {
+		byID[s.SpanContext.SpanID] = s
+	}
+
+	var roots []*span
+	for _, s := range spans {
+		if parent, ok := byID[s.Parent.SpanID]; ok && parent != s {
+			parent.children = append(parent.children, s)
+			continue
+		}
+		roots = append(roots, s)
+	}
+
+	sortSpans(roots)
+	for _, s := range spans {
+		sortSpans(s.children)
+	}
+	return roots
+}
+
+func sortSpans(spans []*span) {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+}
+
+func render(w io.Writer, s *span, start time.Time, depth int, attrs bool) {
+	indent := strings.Repeat("  ", depth)
+
+	line := fmt.Sprintf("%s%s %s +%s", indent, s.Name, s.EndTime.Sub(s.StartTime), s.StartTime.Sub(start))
+	if kind, ok := kinds[s.SpanKind]; ok && kind != "internal" {
+		line += " [" + kind + "]"
+	}
+	if s.Status.Code == "Error" {
+		line += " ERROR"
+		if s.Status.Description != "" {
+			line += ": " + s.Status.Description
+		}
+	}
+	fmt.Fprintln(w, line)
+
+	if attrs {
+		for _, a := range s.Attributes {
+			fmt.Fprintf(w, "%s    %s=%v\n", indent, a.Key, a.Value.Value)
+		}
+	}
+	for _, child := range s.children {
+		render(w, child, start, depth+1, attrs)
+	}
+}
+
+func main() {
+	traceID := flag.String("trace", "", "only show this trace")
+	attrs := flag.Bool("attrs", false, "show span attributes")
+	flag.Parse()
+
+	traces := map[string][]*span{}
+	if flag.NArg() == 0 {
+		if err := read(os.Stdin, traces); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = read(f, traces)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	type trace struct {
+		id    string
+		roots []*span
+	}
+	var out []trace
+	for id, spans := range traces {
+		if *traceID != "" && id != *traceID {
+			continue
+		}
+		out = append(out, trace{id, tree(spans)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].roots[0].StartTime.Before(out[j].roots[0].StartTime)
+	})
+
+	for _, t := range out {
+		fmt.Printf("trace %s\n", t.id)
+		start := t.roots[0].StartTime
+		for _, root := range t.roots {
+			render(os.Stdout, root, start, 1, *attrs)
+		}
+		fmt.Println()
+	}
+}
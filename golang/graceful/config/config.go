@@ -0,0 +1,349 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iamolegga/enviper"
+	"github.com/spf13/viper"
+)
+
+var e = enviper.New(viper.New())
+
+func init() {
+	e.AddConfigPath("./config")
+	e.SetConfigName("default")
+}
+
+type TracingConfig struct {
+	Enabled     bool
+	Type        string
+	Url         string
+	ProjectId   string
+	Propagators []string
+	Otlp        OtlpConfig
+	Pretty      bool
+	File        TraceFileConfig
+	Sampling    SamplingConfig
+	Tail        TailSamplingConfig
+}
+
+// OtlpConfig configures the connection to an OpenTelemetry collector.
+// Headers are key=value pairs, e.g. for an api key.
+type OtlpConfig struct {
+	Insecure    bool
+	Headers     []string
+	CAFile      string
+	CertFile    string
+	KeyFile     string
+	Compression string
+	Timeout     time.Duration
+}
+
+// TraceFileConfig sets when the file exporter rotates, the file itself is
+// the tracing url.
+type TraceFileConfig struct {
+	MaxSize    int64
+	MaxBackups int
+}
+
+// SamplingRule overrides the sampling ratio for a route, e.g. /users/{id},
+// or keeps spans ending with a status, e.g. 5xx. An empty route matches
+// every route. A status rule only keeps the span carrying the status: its
+// children and the downstream services were told the trace isn't sampled,
+// so the span arrives on its own. Use tail sampling to keep whole traces.
+type SamplingRule struct {
+	Route  string
+	Status string
+	Ratio  float64
+}
+
+// SamplingConfig decides which traces are kept. RateLimit caps the traces
+// started per second, 0 is unlimited.
+type SamplingConfig struct {
+	Ratio         float64
+	ParentBased   bool
+	RateLimit     float64
+	Rules         []SamplingRule
+	ExcludedPaths []string
+}
+
+// TailSamplingConfig keeps whole traces once their root span ends: those
+// which errored, took longer than Latency or match a rule, and Ratio of the
+// rest. Buffering is capped at MaxTraces of MaxSpans each, traces whose root
+// doesn't end within DecisionWait (30s by default) or which are pushed out
+// by newer traces are decided on what has arrived. Spans ending after the
+// decision follow it for another DecisionWait, for up to MaxTraces traces.
+type TailSamplingConfig struct {
+	Enabled      bool
+	Latency      time.Duration
+	Ratio        float64
+	Rules        []SamplingRule
+	MaxTraces    int
+	MaxSpans     int
+	DecisionWait time.Duration
+}
+
+type PushgatewayConfig struct {
+	Url      string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type MetricsConfig struct {
+	MaxRoutes   int
+	Type        string
+	Url         string
+	Insecure    bool
+	Interval    time.Duration
+	Pushgateway PushgatewayConfig
+}
+
+// SLOConfig declares the objectives a function is held to, a zero target
+// disables that objective. The counts are only kept in memory, so every
+// replica tracks its own requests and a restart starts the window over.
+type SLOConfig struct {
+	Availability  float64
+	Latency       time.Duration
+	LatencyTarget float64
+	Window        time.Duration
+}
+
+// ResourceConfig picks the detectors describing where the service runs,
+// each is given Timeout before it is skipped. The gcp detector is added on
+// its own when the environment or the metadata server of GKE and GCE say
+// the service runs on Google Cloud.
+type ResourceConfig struct {
+	Detectors []string
+	Timeout   time.Duration
+}
+
+// ClientConfig tunes the http clients handed to functions.
+type ClientConfig struct {
+	Timeout             time.Duration
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	TLSHandshakeTimeout time.Duration
+	IdleConnTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+}
+
+// BaggageConfig lists the baggage members, e.g. tenant.id, which are put on
+// spans and logs. With MetricLabels they also label a request counter, up to
+// MaxValues distinct values each.
+type BaggageConfig struct {
+	Members      []string
+	MetricLabels bool
+	MaxValues    int
+}
+
+// LogSamplingConfig logs the first Initial entries with the same message
+// every Tick and then every Thereafter-th, Initial 0 logs everything.
+type LogSamplingConfig struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// LoggingConfig configures the logger, Format is json or text.
+type LoggingConfig struct {
+	Level    string
+	Format   string
+	Sampling LogSamplingConfig
+}
+
+// AccessLogRule logs Ratio of the successful requests to a route.
+type AccessLogRule struct {
+	Route string
+	Ratio float64
+}
+
+// AccessLogConfig writes a line per request to stdout, Format is combined,
+// json or gcp. The client address is read from X-Forwarded-For only when
+// the request comes through one of TrustedProxies, IPs or CIDRs like
+// 10.0.0.0/8.
+type AccessLogConfig struct {
+	Enabled        bool
+	Format         string
+	ExcludedPaths  []string
+	Rules          []AccessLogRule
+	TrustedProxies []string
+}
+
+// CaptureRule captures Ratio of the requests to a route.
+type CaptureRule struct {
+	Route string
+	Ratio float64
+}
+
+// CaptureConfig logs request and response bodies of up to MaxSize bytes
+// with one of the ContentTypes, for Ratio of the requests unless a rule
+// matches the route. Headers listed in RedactHeaders and JSON fields matched
+// by RedactPaths, e.g. $.password, $.items[*].token or $..secret, are
+// replaced before anything is logged, with RedactPaths set other bodies
+// aren't logged at all. With Spans they are also put on the server span.
+type CaptureConfig struct {
+	Enabled       bool
+	MaxSize       int
+	ContentTypes  []string
+	Ratio         float64
+	Rules         []CaptureRule
+	RedactHeaders []string
+	RedactPaths   []string
+	Spans         bool
+}
+
+// AdminConfig serves the admin endpoints on Addr, none when it is empty.
+// Callers need the bearer token in TokenFile, usually a mounted secret.
+// Log level changes revert after TTL, or the ttl asked for up to MaxTTL.
+type AdminConfig struct {
+	Addr      string
+	TokenFile string
+	TTL       time.Duration
+	MaxTTL    time.Duration
+}
+
+// HealthConfig fails liveness once more than MaxGoroutines are running,
+// zero turns the check off.
+type HealthConfig struct {
+	MaxGoroutines int
+}
+
+type RuntimeConfig struct {
+	MaxProcs         int
+	MemoryLimit      int64
+	MemoryLimitRatio float64
+}
+
+type Config struct {
+	Environment   string
+	ServiceName   string
+	Version       string
+	SrvAddr       string
+	MetricsAddr   string
+	HealthAddr    string
+	ShutdownDelay time.Duration
+	Health        HealthConfig
+	Admin         AdminConfig
+	Runtime       RuntimeConfig
+	Logging       LoggingConfig
+	AccessLog     AccessLogConfig
+	Capture       CaptureConfig
+	Metrics       MetricsConfig
+	Tracing       TracingConfig
+	Resource      ResourceConfig
+	Client        ClientConfig
+	Baggage       BaggageConfig
+	SLO           SLOConfig
+}
+
+func newConfig() *Config {
+	return &Config{
+		Environment:   "production",
+		ServiceName:   "service",
+		Version:       "1.0.0",
+		SrvAddr:       ":8080",
+		MetricsAddr:   ":8081",
+		HealthAddr:    ":8082",
+		ShutdownDelay: 5 * time.Second,
+		Health: HealthConfig{
+			MaxGoroutines: 10000,
+		},
+		Admin: AdminConfig{
+			TokenFile: "/var/openfaas/secrets/admin-token",
+			TTL:       15 * time.Minute,
+			MaxTTL:    24 * time.Hour,
+		},
+		Runtime: RuntimeConfig{
+			MemoryLimitRatio: 0.9,
+		},
+		AccessLog: AccessLogConfig{
+			Format:        "json",
+			ExcludedPaths: []string{"/_/health", "/_/ready", "/healthz", "/live", "/ready", "/health", "/metrics"},
+		},
+		Capture: CaptureConfig{
+			MaxSize:       4096,
+			ContentTypes:  []string{"application/json", "application/x-www-form-urlencoded"},
+			Ratio:         1,
+			RedactHeaders: []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key"},
+			RedactPaths:   []string{"$..password", "$..token", "$..secret"},
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+			Sampling: LogSamplingConfig{
+				Thereafter: 100,
+				Tick:       time.Second,
+			},
+		},
+		Metrics: MetricsConfig{
+			MaxRoutes: 100,
+			Type:      "prometheus",
+			Interval:  time.Minute,
+			Pushgateway: PushgatewayConfig{
+				Interval: time.Minute,
+				Timeout:  10 * time.Second,
+			},
+		},
+		Tracing: TracingConfig{
+			Propagators: []string{"tracecontext", "baggage"},
+			Otlp: OtlpConfig{
+				Timeout: 10 * time.Second,
+			},
+			File: TraceFileConfig{
+				MaxSize:    10 << 20,
+				MaxBackups: 3,
+			},
+			Sampling: SamplingConfig{
+				Ratio:         1,
+				ParentBased:   true,
+				ExcludedPaths: []string{"/_/health", "/_/ready", "/healthz", "/live", "/ready", "/health", "/metrics"},
+			},
+			Tail: TailSamplingConfig{
+				Latency:      time.Second,
+				Ratio:        0.1,
+				MaxTraces:    10000,
+				MaxSpans:     1000,
+				DecisionWait: 30 * time.Second,
+			},
+		},
+		Resource: ResourceConfig{
+			Detectors: []string{"env", "host", "k8s", "faas"},
+			Timeout:   2 * time.Second,
+		},
+		Client: ClientConfig{
+			Timeout:             30 * time.Second,
+			DialTimeout:         5 * time.Second,
+			KeepAlive:           30 * time.Second,
+			TLSHandshakeTimeout: 5 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+		},
+		Baggage: BaggageConfig{
+			MaxValues: 100,
+		},
+		SLO: SLOConfig{
+			Window: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+func (c *Config) Parse(cfg interface{}) error {
+	if err := e.Unmarshal(cfg); err != nil {
+		return fmt.Errorf("unmarshal config: %w", err)
+	}
+	return nil
+}
+
+func NewConfig(ctx context.Context) (*Config, error) {
+	cfg := newConfig()
+	if err := e.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	return cfg, nil
+}
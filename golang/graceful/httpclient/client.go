@@ -0,0 +1,97 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// Factory hands out instrumented clients which share one connection pool.
+type Factory struct {
+	timeout   time.Duration
+	pool      *http.Transport
+	transport http.RoundTripper
+}
+
+// Client returns a client with the default timeout.
+func (f *Factory) Client() *http.Client {
+	return &http.Client{
+		Timeout:   f.timeout,
+		Transport: f.transport,
+	}
+}
+
+// Transport returns the instrumented pooled transport for clients which need
+// other settings.
+func (f *Factory) Transport() http.RoundTripper {
+	return f.transport
+}
+
+// CloseIdleConnections drops the pooled connections, e.g. on shutdown.
+func (f *Factory) CloseIdleConnections() {
+	f.pool.CloseIdleConnections()
+}
+
+func NewFactory(cfg config.ClientConfig) *Factory {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	pool := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &Factory{
+		timeout:   cfg.Timeout,
+		pool:      pool,
+		transport: Wrap(pool),
+	}
+}
+
+type factoryKey struct{}
+
+// fallback is handed out when no factory was set, so functions keep working
+// in tests without one.
+var fallback = NewFactory(config.ClientConfig{
+	Timeout:             30 * time.Second,
+	DialTimeout:         5 * time.Second,
+	KeepAlive:           30 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+	IdleConnTimeout:     90 * time.Second,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+})
+
+// CloseIdleConnections drops the pooled connections of the factory handed
+// out when none was set, e.g. on shutdown.
+func CloseIdleConnections() {
+	fallback.CloseIdleConnections()
+}
+
+func WithFactory(ctx context.Context, f *Factory) context.Context {
+	return context.WithValue(ctx, factoryKey{}, f)
+}
+
+// FromContext returns the factory passed to function.NewHandler.
+func FromContext(ctx context.Context) *Factory {
+	if f, ok := ctx.Value(factoryKey{}).(*Factory); ok {
+		return f
+	}
+	return fallback
+}
+
+// New is short for FromContext(ctx).Client().
+func New(ctx context.Context) *http.Client {
+	return FromContext(ctx).Client()
+}
@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestFallbackTimeouts(t *testing.T) {
+	f := FromContext(context.Background())
+	if f != fallback {
+		t.Fatal("no factory set should hand out the fallback")
+	}
+	if got := New(context.Background()).Timeout; got != 30*time.Second {
+		t.Errorf("client timeout = %v, want 30s", got)
+	}
+	if got := f.pool.TLSHandshakeTimeout; got != 5*time.Second {
+		t.Errorf("tls handshake timeout = %v, want 5s", got)
+	}
+	if got := f.pool.IdleConnTimeout; got != 90*time.Second {
+		t.Errorf("idle timeout = %v, want 90s", got)
+	}
+	if f.pool.MaxIdleConnsPerHost != 10 {
+		t.Errorf("idle connections per host = %d, want 10", f.pool.MaxIdleConnsPerHost)
+	}
+}
+
+func TestFactoryFromContext(t *testing.T) {
+	cfg := config.ClientConfig{
+		Timeout:             time.Second,
+		TLSHandshakeTimeout: 2 * time.Second,
+		IdleConnTimeout:     3 * time.Second,
+		MaxIdleConnsPerHost: 4,
+		MaxConnsPerHost:     5,
+	}
+	f := NewFactory(cfg)
+	ctx := WithFactory(context.Background(), f)
+
+	if FromContext(ctx) != f {
+		t.Fatal("factory not passed through the context")
+	}
+	client := New(ctx)
+	if client.Timeout != cfg.Timeout {
+		t.Errorf("client timeout = %v, want %v", client.Timeout, cfg.Timeout)
+	}
+	if client.Transport != f.Transport() {
+		t.Error("client doesn't share the instrumented pool")
+	}
+	if f.pool.TLSHandshakeTimeout != cfg.TLSHandshakeTimeout || f.pool.IdleConnTimeout != cfg.IdleConnTimeout {
+		t.Errorf("pool timeouts = %v/%v", f.pool.TLSHandshakeTimeout, f.pool.IdleConnTimeout)
+	}
+	if f.pool.MaxIdleConnsPerHost != cfg.MaxIdleConnsPerHost || f.pool.MaxConnsPerHost != cfg.MaxConnsPerHost {
+		t.Errorf("pool limits = %d/%d", f.pool.MaxIdleConnsPerHost, f.pool.MaxConnsPerHost)
+	}
+}
@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/metrics"
+)
+
+const instrumentationName = "github.com/contextcloud/graceful/httpclient"
+
+// maxHosts caps the hosts labelling the client metrics, calls to any more
+// hosts are labelled otherHost.
+const (
+	maxHosts  = 100
+	otherHost = "other"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "The latency of outgoing HTTP requests by host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "method", "code"})
+	requestsInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "http_client",
+		Name:      "requests_inflight",
+		Help:      "The number of outgoing HTTP requests waiting on a response.",
+	}, []string{"host"})
+)
+
+// hosts is shared by every transport as they all record to the same
+// metrics.
+var hosts = metrics.NewBoundedLabel(maxHosts, otherHost)
+
+func init() {
+	prometheus.MustRegister(requestDuration, requestsInflight)
+}
+
+// transport records a client span and the latency of every request and
+// passes the trace on to the server.
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(r.Context(), "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(r)...),
+	)
+	defer span.End()
+
+	// a RoundTripper mustn't modify the request it was given.
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	host := hosts.Label(r.URL.Host)
+	requestsInflight.WithLabelValues(host).Inc()
+	defer requestsInflight.WithLabelValues(host).Dec()
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(r)
+
+	code := "error"
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		code = strconv.Itoa(res.StatusCode)
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(res.StatusCode)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(res.StatusCode, trace.SpanKindClient))
+	}
+	metrics.Observe(ctx, requestDuration.WithLabelValues(host, r.Method, code), time.Since(start).Seconds())
+
+	return res, err
+}
+
+// Wrap instruments a transport, e.g. one from an SDK which brings its own.
+func Wrap(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
@@ -0,0 +1,165 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/contextcloud/graceful/metrics"
+)
+
+func withTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func host(s *httptest.Server) string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// sampleCount is how many requests the latency histogram has for the labels.
+func sampleCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := requestDuration.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestTransportPropagates(t *testing.T) {
+	exporter := withTracing(t)
+
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	member, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/users", nil)
+	res, err := (&http.Client{Transport: Wrap(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans, want the client span", len(spans))
+	}
+	span := spans[0]
+	want := "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"
+	if got := headers.Get("traceparent"); got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+	if got := headers.Get("baggage"); got != "tenant=acme" {
+		t.Errorf("baggage = %q", got)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Error("the caller's request was modified")
+	}
+}
+
+func TestTransportSpanStatus(t *testing.T) {
+	tests := map[string]struct {
+		code   int
+		closed bool
+		want   codes.Code
+	}{
+		"ok":           {code: http.StatusOK, want: codes.Unset},
+		"not found":    {code: http.StatusNotFound, want: codes.Error},
+		"server error": {code: http.StatusBadGateway, want: codes.Error},
+		"no server":    {closed: true, want: codes.Error},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			exporter := withTracing(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+			}))
+			defer server.Close()
+			if tt.closed {
+				server.Close()
+			}
+
+			code := "error"
+			if !tt.closed {
+				code = strconv.Itoa(tt.code)
+			}
+			before := sampleCount(t, hosts.Label(host(server)), http.MethodGet, code)
+
+			res, err := (&http.Client{Transport: Wrap(nil)}).Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("%d spans, want the client span", len(spans))
+			}
+			if got := spans[0].Status.Code; got != tt.want {
+				t.Errorf("status = %v, want %v", got, tt.want)
+			}
+			if tt.closed && len(spans[0].Events) == 0 {
+				t.Error("the error wasn't recorded")
+			}
+			if got := sampleCount(t, hosts.Label(host(server)), http.MethodGet, code) - before; got != 1 {
+				t.Errorf("latency recorded %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestTransportBoundsHosts(t *testing.T) {
+	withTracing(t)
+	defer func(previous *metrics.BoundedLabel) { hosts = previous }(hosts)
+	hosts = metrics.NewBoundedLabel(1, otherHost)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	first := httptest.NewServer(handler)
+	defer first.Close()
+	second := httptest.NewServer(handler)
+	defer second.Close()
+
+	beforeFirst := sampleCount(t, host(first), http.MethodGet, "200")
+	beforeOther := sampleCount(t, otherHost, http.MethodGet, "200")
+	client := &http.Client{Transport: Wrap(nil)}
+	for _, server := range []*httptest.Server{first, second, second} {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if got := sampleCount(t, host(first), http.MethodGet, "200") - beforeFirst; got != 1 {
+		t.Errorf("first host recorded %d times, want 1", got)
+	}
+	if got := sampleCount(t, otherHost, http.MethodGet, "200") - beforeOther; got != 2 {
+		t.Errorf("hosts past the limit recorded %d times as other, want 2", got)
+	}
+}
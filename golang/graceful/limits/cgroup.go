@@ -0,0 +1,168 @@
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "sys/fs/cgroup"
+
+// anything above this is how cgroup v1 spells "no limit".
+const unlimitedMemory = int64(1) << 62
+
+// Cgroup is the cpu and memory limit of the cgroup we are running in, zero
+// means unlimited.
+type Cgroup struct {
+	CPUQuota    float64 `json:"cpuQuota,omitempty"`
+	MemoryLimit int64   `json:"memoryLimit,omitempty"`
+}
+
+// ReadCgroup reads the limits of the current process from fsys, which is
+// usually os.DirFS("/"). Both cgroup v2 and v1 hierarchies are supported.
+func ReadCgroup(fsys fs.FS) (Cgroup, error) {
+	if _, err := fs.Stat(fsys, path.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return readCgroupV2(fsys)
+	}
+	return readCgroupV1(fsys)
+}
+
+func readCgroupV2(fsys fs.FS) (Cgroup, error) {
+	var out Cgroup
+	dirs := candidates(cgroupRoot, selfCgroup(fsys, ""))
+
+	cpu, err := readFirst(fsys, dirs, "cpu.max")
+	if err != nil {
+		return out, err
+	}
+	if fields := strings.Fields(cpu); len(fields) == 2 && fields[0] != "max" {
+		quota, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return out, fmt.Errorf("parse cpu.max: %w", err)
+		}
+		period, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return out, fmt.Errorf("parse cpu.max: %w", err)
+		}
+		if period > 0 {
+			out.CPUQuota = quota / period
+		}
+	}
+
+	mem, err := readFirst(fsys, dirs, "memory.max")
+	if err != nil {
+		return out, err
+	}
+	if mem != "" && mem != "max" {
+		limit, err := strconv.ParseInt(mem, 10, 64)
+		if err != nil {
+			return out, fmt.Errorf("parse memory.max: %w", err)
+		}
+		out.MemoryLimit = limit
+	}
+
+	return out, nil
+}
+
+func readCgroupV1(fsys fs.FS) (Cgroup, error) {
+	var out Cgroup
+
+	cpuDirs := append(
+		candidates(path.Join(cgroupRoot, "cpu"), selfCgroup(fsys, "cpu")),
+		candidates(path.Join(cgroupRoot, "cpu,cpuacct"), selfCgroup(fsys, "cpu"))...,
+	)
+	quota, err := readFirst(fsys, cpuDirs, "cpu.cfs_quota_us")
+	if err != nil {
+		return out, err
+	}
+	period, err := readFirst(fsys, cpuDirs, "cpu.cfs_period_us")
+	if err != nil {
+		return out, err
+	}
+	if quota != "" && period != "" && quota != "-1" {
+		q, err := strconv.ParseFloat(quota, 64)
+		if err != nil {
+			return out, fmt.Errorf("parse cpu.cfs_quota_us: %w", err)
+		}
+		p, err := strconv.ParseFloat(period, 64)
+		if err != nil {
+			return out, fmt.Errorf("parse cpu.cfs_period_us: %w", err)
+		}
+		if q > 0 && p > 0 {
+			out.CPUQuota = q / p
+		}
+	}
+
+	memDirs := candidates(path.Join(cgroupRoot, "memory"), selfCgroup(fsys, "memory"))
+	mem, err := readFirst(fsys, memDirs, "memory.limit_in_bytes")
+	if err != nil {
+		return out, err
+	}
+	if mem != "" {
+		limit, err := strconv.ParseInt(mem, 10, 64)
+		if err != nil {
+			return out, fmt.Errorf("parse memory.limit_in_bytes: %w", err)
+		}
+		if limit < unlimitedMemory {
+			out.MemoryLimit = limit
+		}
+	}
+
+	return out, nil
+}
+
+// selfCgroup finds the cgroup path of the current process for a v1
+// controller, or the unified hierarchy when controller is empty.
+func selfCgroup(fsys fs.FS, controller string) string {
+	f, err := fsys.Open("proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if controller == "" && parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if controller != "" && c == controller {
+				return parts[2]
+			}
+		}
+	}
+	return ""
+}
+
+// candidates prefers the nested cgroup of the process and falls back to the
+// mount point, which is what we see inside a cgroup namespace.
+func candidates(mount string, self string) []string {
+	self = strings.TrimPrefix(path.Clean("/"+self), "/")
+	if self == "" {
+		return []string{mount}
+	}
+	return []string{path.Join(mount, self), mount}
+}
+
+func readFirst(fsys fs.FS, dirs []string, name string) (string, error) {
+	for _, dir := range dirs {
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,120 @@
+package limits
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func TestReadCgroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    Cgroup
+		wantErr bool
+	}{
+		{
+			name: "v2",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cgroup.controllers": file("cpu memory"),
+				"sys/fs/cgroup/cpu.max":            file("150000 100000\n"),
+				"sys/fs/cgroup/memory.max":         file("536870912\n"),
+			},
+			want: Cgroup{CPUQuota: 1.5, MemoryLimit: 536870912},
+		},
+		{
+			name: "v2 max",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cgroup.controllers": file("cpu memory"),
+				"sys/fs/cgroup/cpu.max":            file("max 100000\n"),
+				"sys/fs/cgroup/memory.max":         file("max\n"),
+			},
+		},
+		{
+			name: "v2 missing files",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cgroup.controllers": file("cpu memory"),
+			},
+		},
+		{
+			name: "v2 nested cgroup",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup":                       file("0::/kubepods/pod1\n"),
+				"sys/fs/cgroup/cgroup.controllers":       file("cpu memory"),
+				"sys/fs/cgroup/cpu.max":                  file("max 100000\n"),
+				"sys/fs/cgroup/kubepods/pod1/cpu.max":    file("50000 100000\n"),
+				"sys/fs/cgroup/kubepods/pod1/memory.max": file("268435456\n"),
+			},
+			want: Cgroup{CPUQuota: 0.5, MemoryLimit: 268435456},
+		},
+		{
+			name: "v2 bad quota",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cgroup.controllers": file("cpu memory"),
+				"sys/fs/cgroup/cpu.max":            file("lots 100000\n"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "v1",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cpu/cpu.cfs_quota_us":         file("200000\n"),
+				"sys/fs/cgroup/cpu/cpu.cfs_period_us":        file("100000\n"),
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": file("1073741824\n"),
+			},
+			want: Cgroup{CPUQuota: 2, MemoryLimit: 1073741824},
+		},
+		{
+			name: "v1 cpu,cpuacct",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us":  file("25000\n"),
+				"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_period_us": file("100000\n"),
+			},
+			want: Cgroup{CPUQuota: 0.25},
+		},
+		{
+			name: "v1 unlimited",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/cpu/cpu.cfs_quota_us":         file("-1\n"),
+				"sys/fs/cgroup/cpu/cpu.cfs_period_us":        file("100000\n"),
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": file("9223372036854771712\n"),
+			},
+		},
+		{
+			name: "v1 nested cgroup",
+			fsys: fstest.MapFS{
+				"proc/self/cgroup": file("4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n"),
+				"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  file("300000\n"),
+				"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": file("100000\n"),
+				"sys/fs/cgroup/memory/docker/abc/memory.limit_in_bytes":  file("2147483648\n"),
+			},
+			want: Cgroup{CPUQuota: 3, MemoryLimit: 2147483648},
+		},
+		{
+			name: "none",
+			fsys: fstest.MapFS{},
+		},
+		{
+			name: "v1 bad memory",
+			fsys: fstest.MapFS{
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": file("lots\n"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCgroup(tt.fsys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCgroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ReadCgroup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
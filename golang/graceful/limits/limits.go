@@ -0,0 +1,117 @@
+package limits
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+var (
+	maxProcsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "runtime_gomaxprocs",
+		Help: "GOMAXPROCS chosen at startup.",
+	})
+	memLimitGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "runtime_gomemlimit_bytes",
+		Help: "GOMEMLIMIT chosen at startup, 0 when unlimited.",
+	})
+	cpuQuotaGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cgroup_cpu_quota_cores",
+		Help: "CPU quota of the container cgroup, 0 when unlimited.",
+	})
+	memoryLimitGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cgroup_memory_limit_bytes",
+		Help: "Memory limit of the container cgroup, 0 when unlimited.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(maxProcsGauge, memLimitGauge, cpuQuotaGauge, memoryLimitGauge)
+}
+
+// Limits are the runtime settings picked for this process and where they
+// came from.
+type Limits struct {
+	Cgroup         Cgroup `json:"cgroup"`
+	MaxProcs       int    `json:"maxProcs"`
+	MaxProcsSource string `json:"maxProcsSource"`
+	MemLimit       int64  `json:"memLimit,omitempty"`
+	MemLimitSource string `json:"memLimitSource"`
+}
+
+// Compute works out GOMAXPROCS and GOMEMLIMIT without changing the runtime.
+// The GOMAXPROCS and GOMEMLIMIT environment variables win over the config,
+// which wins over the cgroup.
+func Compute(cfg config.RuntimeConfig, fsys fs.FS) (*Limits, error) {
+	cgroup, err := ReadCgroup(fsys)
+
+	out := &Limits{
+		Cgroup:         cgroup,
+		MaxProcs:       runtime.GOMAXPROCS(0),
+		MaxProcsSource: "default",
+		MemLimitSource: "default",
+	}
+
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		out.MaxProcsSource = "env"
+	case cfg.MaxProcs > 0:
+		out.MaxProcs = cfg.MaxProcs
+		out.MaxProcsSource = "config"
+	case cgroup.CPUQuota > 0:
+		// a quota above the cores of the node can't be used anyway.
+		out.MaxProcs = int(math.Ceil(cgroup.CPUQuota))
+		if n := runtime.NumCPU(); out.MaxProcs > n {
+			out.MaxProcs = n
+		}
+		if out.MaxProcs < 1 {
+			out.MaxProcs = 1
+		}
+		out.MaxProcsSource = "cgroup"
+	}
+
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		out.MemLimit = debug.SetMemoryLimit(-1)
+		out.MemLimitSource = "env"
+	case cfg.MemoryLimit > 0:
+		out.MemLimit = cfg.MemoryLimit
+		out.MemLimitSource = "config"
+	case cgroup.MemoryLimit > 0 && cfg.MemoryLimitRatio > 0:
+		out.MemLimit = int64(float64(cgroup.MemoryLimit) * cfg.MemoryLimitRatio)
+		out.MemLimitSource = "cgroup"
+	}
+
+	if err != nil {
+		return out, fmt.Errorf("read cgroup limits: %w", err)
+	}
+	return out, nil
+}
+
+// Apply sets GOMAXPROCS and GOMEMLIMIT from Compute. A cgroup which cannot
+// be read is returned as an error but whatever could be worked out is still
+// applied.
+func Apply(cfg config.RuntimeConfig, fsys fs.FS) (*Limits, error) {
+	out, err := Compute(cfg, fsys)
+
+	if out.MaxProcsSource != "env" {
+		runtime.GOMAXPROCS(out.MaxProcs)
+	}
+	if out.MemLimitSource != "env" && out.MemLimit > 0 {
+		debug.SetMemoryLimit(out.MemLimit)
+	}
+
+	maxProcsGauge.Set(float64(out.MaxProcs))
+	memLimitGauge.Set(float64(out.MemLimit))
+	cpuQuotaGauge.Set(out.Cgroup.CPUQuota)
+	memoryLimitGauge.Set(float64(out.Cgroup.MemoryLimit))
+
+	return out, err
+}
@@ -0,0 +1,75 @@
+package limits
+
+import (
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func cpuQuota(quota string) fstest.MapFS {
+	return fstest.MapFS{
+		"sys/fs/cgroup/cgroup.controllers": file("cpu memory"),
+		"sys/fs/cgroup/cpu.max":            file(quota),
+		"sys/fs/cgroup/memory.max":         file("1000\n"),
+	}
+}
+
+func TestCompute(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	tests := []struct {
+		name         string
+		cfg          config.RuntimeConfig
+		fsys         fstest.MapFS
+		wantProcs    int
+		wantSource   string
+		wantMemLimit int64
+	}{
+		{
+			name:         "fractional quota rounds up",
+			cfg:          config.RuntimeConfig{MemoryLimitRatio: 0.9},
+			fsys:         cpuQuota("50000 100000"),
+			wantProcs:    1,
+			wantSource:   "cgroup",
+			wantMemLimit: 900,
+		},
+		{
+			name:       "quota above the node is clamped",
+			fsys:       cpuQuota("100000000 100000"),
+			wantProcs:  runtime.NumCPU(),
+			wantSource: "cgroup",
+		},
+		{
+			name:         "config wins",
+			cfg:          config.RuntimeConfig{MaxProcs: 3, MemoryLimit: 42, MemoryLimitRatio: 0.9},
+			fsys:         cpuQuota("50000 100000"),
+			wantProcs:    3,
+			wantSource:   "config",
+			wantMemLimit: 42,
+		},
+		{
+			name:       "unlimited",
+			fsys:       cpuQuota("max 100000"),
+			wantProcs:  runtime.GOMAXPROCS(0),
+			wantSource: "default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compute(tt.cfg, tt.fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.MaxProcs != tt.wantProcs || got.MaxProcsSource != tt.wantSource {
+				t.Errorf("MaxProcs = %d (%s), want %d (%s)", got.MaxProcs, got.MaxProcsSource, tt.wantProcs, tt.wantSource)
+			}
+			if got.MemLimit != tt.wantMemLimit {
+				t.Errorf("MemLimit = %d, want %d", got.MemLimit, tt.wantMemLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != zap.L() {
+		t.Error("outside a request the global logger should be returned")
+	}
+
+	logger := zap.NewNop().With(zap.String("request_id", "abc"))
+	ctx := WithLogger(context.Background(), logger)
+	if got := FromContext(ctx); got != logger {
+		t.Error("request logger not returned")
+	}
+}
@@ -0,0 +1,231 @@
+package logging
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// level is the level of the process or of a named logger. Temporary levels
+// keep what to go back to, unset when the logger had no level of its own.
+type level struct {
+	level   zapcore.Level
+	expires time.Time
+	gen     uint64
+
+	revert    zapcore.Level
+	revertSet bool
+	timer     *time.Timer
+}
+
+// Levels is the process log level plus levels for named loggers, e.g.
+// "httpclient", which also apply to their children like "httpclient.retry".
+// Every change is logged, however quiet the levels are.
+type Levels struct {
+	audit *zap.Logger
+
+	mu    sync.RWMutex
+	gen   uint64
+	base  *level
+	named map[string]*level
+}
+
+// LevelState is a level and when it reverts, if it is temporary.
+type LevelState struct {
+	Level   string     `json:"level"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// LevelsState is the process level and the levels of named loggers.
+type LevelsState struct {
+	LevelState
+	Loggers map[string]LevelState `json:"loggers,omitempty"`
+}
+
+func newLevels(base zapcore.Level, audit *zap.Logger) *Levels {
+	return &Levels{
+		audit: audit.Named("logging"),
+		base:  &level{level: base},
+		named: make(map[string]*level),
+	}
+}
+
+// Level is the level of a logger, the one of its closest named parent or
+// the process level.
+func (l *Levels) Level(name string) zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for name != "" {
+		if lvl, ok := l.named[name]; ok {
+			return lvl.level
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return l.base.level
+}
+
+// min is the most verbose level of any logger.
+func (l *Levels) min() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	min := l.base.level
+	for _, lvl := range l.named {
+		if lvl.level < min {
+			min = lvl.level
+		}
+	}
+	return min
+}
+
+func (l *Levels) lookup(name string) (*level, bool) {
+	if name == "" {
+		return l.base, true
+	}
+	lvl, ok := l.named[name]
+	return lvl, ok
+}
+
+// Set changes the level of a named logger, or of the process when name is
+// empty. With a ttl it goes back to the level from before the first of a
+// run of temporary changes once the ttl has passed. The fields say who
+// asked for the change.
+func (l *Levels) Set(name string, to zapcore.Level, ttl time.Duration, fields ...zap.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	from := "unset"
+	lvl, ok := l.lookup(name)
+	switch {
+	case !ok:
+		lvl = &level{}
+		l.named[name] = lvl
+	case lvl.timer != nil:
+		// a temporary level being replaced still goes back to the original.
+		from = lvl.level.String()
+		lvl.timer.Stop()
+		lvl.timer = nil
+	default:
+		from = lvl.level.String()
+		lvl.revert, lvl.revertSet = lvl.level, true
+	}
+
+	l.gen++
+	lvl.gen = l.gen
+	lvl.level = to
+	lvl.expires = time.Time{}
+	if ttl > 0 {
+		gen := lvl.gen
+		lvl.expires = time.Now().Add(ttl)
+		lvl.timer = time.AfterFunc(ttl, func() { l.expire(name, gen) })
+	}
+
+	l.audit.Info("log level changed", append(fields,
+		zap.String("logger_name", name),
+		zap.String("from", from),
+		zap.String("to", to.String()),
+		zap.Duration("ttl", ttl),
+	)...)
+}
+
+func (l *Levels) expire(name string, gen uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a later change took over.
+	lvl, ok := l.lookup(name)
+	if !ok || lvl.gen != gen || lvl.timer == nil {
+		return
+	}
+	lvl.timer = nil
+	lvl.expires = time.Time{}
+
+	from, to := lvl.level.String(), "unset"
+	if lvl.revertSet {
+		lvl.level = lvl.revert
+		to = lvl.level.String()
+	} else {
+		delete(l.named, name)
+	}
+
+	l.audit.Info("log level reverted",
+		zap.String("logger_name", name),
+		zap.String("from", from),
+		zap.String("to", to),
+	)
+}
+
+// Reset drops the level of a named logger so it follows its parent again.
+func (l *Levels) Reset(name string, fields ...zap.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lvl, ok := l.named[name]
+	if !ok {
+		return
+	}
+	if lvl.timer != nil {
+		lvl.timer.Stop()
+	}
+	delete(l.named, name)
+
+	l.audit.Info("log level changed", append(fields,
+		zap.String("logger_name", name),
+		zap.String("from", lvl.level.String()),
+		zap.String("to", "unset"),
+	)...)
+}
+
+func (lvl *level) state() LevelState {
+	out := LevelState{Level: lvl.level.String()}
+	if lvl.timer != nil {
+		expires := lvl.expires
+		out.Expires = &expires
+	}
+	return out
+}
+
+// State reports the current levels.
+func (l *Levels) State() LevelsState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := LevelsState{LevelState: l.base.state()}
+	if len(l.named) > 0 {
+		out.Loggers = make(map[string]LevelState, len(l.named))
+		for name, lvl := range l.named {
+			out.Loggers[name] = lvl.state()
+		}
+	}
+	return out
+}
+
+// levelCore filters entries by the level of the logger which wrote them,
+// the core it wraps takes everything.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.levels.min()
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if e.Level < c.levels.Level(e.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(e, ce)
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestLevels() (*Levels, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return newLevels(zapcore.InfoLevel, zap.New(core)), logs
+}
+
+// eventually waits for the level of name to become want.
+func eventually(t *testing.T, l *Levels, name string, want zapcore.Level) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Level(name) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("level of %q = %s, want %s", name, l.Level(name), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLevelsTTL(t *testing.T) {
+	l, logs := newTestLevels()
+
+	l.Set("httpclient", zapcore.DebugLevel, 20*time.Millisecond)
+	if got := l.Level("httpclient.retry"); got != zapcore.DebugLevel {
+		t.Fatalf("child level = %s, want debug", got)
+	}
+	if got := l.Level("server"); got != zapcore.InfoLevel {
+		t.Fatalf("other logger level = %s, want info", got)
+	}
+	if l.State().Loggers["httpclient"].Expires == nil {
+		t.Error("temporary level without an expiry")
+	}
+
+	// the named level goes away, the logger follows the process again.
+	eventually(t, l, "httpclient", zapcore.InfoLevel)
+	if _, ok := l.State().Loggers["httpclient"]; ok {
+		t.Error("expired level still listed")
+	}
+	if got := logs.FilterMessage("log level reverted").Len(); got != 1 {
+		t.Errorf("%d reverts logged, want 1", got)
+	}
+}
+
+func TestLevelsNestedTTL(t *testing.T) {
+	tests := map[string]struct {
+		name      string
+		permanent *zapcore.Level
+		want      zapcore.Level
+	}{
+		"process": {want: zapcore.InfoLevel},
+		"named": {
+			name:      "httpclient",
+			permanent: levelPtr(zapcore.ErrorLevel),
+			want:      zapcore.ErrorLevel,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			l, _ := newTestLevels()
+			if tt.permanent != nil {
+				l.Set(tt.name, *tt.permanent, 0)
+			}
+
+			// a temporary level replacing another goes back to the original,
+			// not to the one it replaced.
+			l.Set(tt.name, zapcore.DebugLevel, time.Hour)
+			l.Set(tt.name, zapcore.WarnLevel, 20*time.Millisecond)
+			if got := l.Level(tt.name); got != zapcore.WarnLevel {
+				t.Fatalf("level = %s, want warn", got)
+			}
+
+			eventually(t, l, tt.name, tt.want)
+		})
+	}
+}
+
+func TestLevelsResetStopsTimer(t *testing.T) {
+	l, logs := newTestLevels()
+
+	l.Set("httpclient", zapcore.DebugLevel, 20*time.Millisecond)
+	timer := l.named["httpclient"].timer
+	l.Reset("httpclient")
+	if timer.Stop() {
+		t.Error("timer still running after reset")
+	}
+	if got := l.Level("httpclient"); got != zapcore.InfoLevel {
+		t.Fatalf("level after reset = %s, want info", got)
+	}
+
+	// a level set for good afterwards outlives the old ttl.
+	l.Set("httpclient", zapcore.ErrorLevel, 0)
+	time.Sleep(60 * time.Millisecond)
+	if got := l.Level("httpclient"); got != zapcore.ErrorLevel {
+		t.Errorf("level = %s, want error", got)
+	}
+	if got := logs.FilterMessage("log level reverted").Len(); got != 0 {
+		t.Errorf("%d reverts logged after reset", got)
+	}
+}
+
+func levelPtr(l zapcore.Level) *zapcore.Level {
+	return &l
+}
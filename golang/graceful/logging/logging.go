@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/platform"
+)
+
+func newEncoder(format string) (zapcore.Encoder, error) {
+	switch format {
+	case "", "json":
+		enc := zap.NewProductionEncoderConfig()
+		enc.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+		return zapcore.NewJSONEncoder(enc), nil
+	case "text":
+		enc := zap.NewDevelopmentEncoderConfig()
+		return zapcore.NewConsoleEncoder(enc), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+}
+
+// platformFields tag every entry with where it came from.
+func platformFields(m platform.Metadata) []zap.Field {
+	var fields []zap.Field
+	add := func(key string, value string) {
+		if value != "" {
+			fields = append(fields, zap.String(key, value))
+		}
+	}
+	add("pod", m.PodName)
+	add("namespace", m.PodNamespace)
+	add("node", m.NodeName)
+	add("function", m.FunctionName)
+	return fields
+}
+
+// New builds the process logger. Its levels, for the process and for named
+// loggers, can be changed while running through the returned Levels.
+func New(cfg *config.Config) (*zap.Logger, *Levels, error) {
+	base, err := zapcore.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		return nil, nil, fmt.Errorf("log level: %w", err)
+	}
+
+	enc, err := newEncoder(cfg.Logging.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := []zap.Field{
+		zap.String("service", cfg.ServiceName),
+		zap.String("environment", cfg.Environment),
+		zap.String("version", cfg.Version),
+	}
+	fields = append(fields, platformFields(platform.Detect())...)
+	options := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
+
+	// levels are checked per logger name in front of everything else.
+	core := zapcore.NewCore(enc, zapcore.Lock(os.Stderr), zapcore.DebugLevel)
+	levels := newLevels(base, zap.New(core, options...).With(fields...))
+
+	if sampling := cfg.Logging.Sampling; sampling.Initial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, sampling.Tick, sampling.Initial, sampling.Thereafter)
+	}
+
+	logger := zap.New(&levelCore{Core: core, levels: levels}, options...).With(fields...)
+	return logger, levels, nil
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// captureStderr runs fn with stderr going to a pipe and returns the lines
+// written.
+func captureStderr(t *testing.T, fn func()) []map[string]interface{} {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	fn()
+	w.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	io.Copy(io.Discard, r)
+	return lines
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("K8S_POD_NAME", "orders-1")
+	cfg := &config.Config{
+		ServiceName: "orders",
+		Environment: "test",
+		Version:     "1.0.0",
+		Logging:     config.LoggingConfig{Level: "info"},
+	}
+
+	lines := captureStderr(t, func() {
+		logger, levels, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Debug("hidden")
+		logger.Info("shown", zap.Int("count", 1))
+		logger.Named("db").Debug("hidden too")
+
+		levels.Set("db", zapcore.DebugLevel, 0)
+		logger.Named("db").Debug("named debug")
+		logger.Sync()
+	})
+
+	byMsg := map[string]map[string]interface{}{}
+	for _, line := range lines {
+		byMsg[line["msg"].(string)] = line
+	}
+	for _, hidden := range []string{"hidden", "hidden too"} {
+		if _, ok := byMsg[hidden]; ok {
+			t.Errorf("%q logged below the level", hidden)
+		}
+	}
+
+	shown, ok := byMsg["shown"]
+	if !ok {
+		t.Fatalf("info line missing: %v", lines)
+	}
+	want := map[string]interface{}{
+		"level":       "info",
+		"count":       float64(1),
+		"service":     "orders",
+		"environment": "test",
+		"version":     "1.0.0",
+		"pod":         "orders-1",
+	}
+	for key, value := range want {
+		if shown[key] != value {
+			t.Errorf("%s = %v, want %v", key, shown[key], value)
+		}
+	}
+	if shown["caller"] == nil || shown["ts"] == nil {
+		t.Errorf("caller or time missing: %v", shown)
+	}
+	if named := byMsg["named debug"]; named == nil || named["logger"] != "db" {
+		t.Errorf("named logger line = %v", named)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := map[string]config.LoggingConfig{
+		"level":  {Level: "loud"},
+		"format": {Level: "info", Format: "xml"},
+	}
+
+	for name, logging := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := New(&config.Config{Logging: logging}); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
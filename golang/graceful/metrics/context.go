@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+type registryKey struct{}
+
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// FromContext returns the registry passed to function.NewHandler. Without
+// one it returns a fresh registry which nothing serves, so functions keep
+// working in tests and their registrations can't collide.
+func FromContext(ctx context.Context) *Registry {
+	if r, ok := ctx.Value(registryKey{}).(*Registry); ok {
+		return r
+	}
+	return NewRegistry(&config.Config{})
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Observe records the value with the span in ctx as an exemplar, so a spike
+// on a dashboard leads straight to a trace. Spans which aren't sampled are
+// left out since there would be no trace to jump to.
+func Observe(ctx context.Context, observer prometheus.Observer, value float64) {
+	if labels := traceExemplar(ctx); labels != nil {
+		if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, labels)
+			return
+		}
+	}
+	observer.Observe(value)
+}
+
+func traceExemplar(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// ServiceLabels are the labels every served metric carries so series from
+// different functions can be told apart once they are aggregated.
+func ServiceLabels(cfg *config.Config) prometheus.Labels {
+	return prometheus.Labels{
+		"service":     cfg.ServiceName,
+		"environment": cfg.Environment,
+	}
+}
+
+type labelGatherer struct {
+	gatherer prometheus.Gatherer
+	labels   prometheus.Labels
+}
+
+// Gather adds the labels to every metric, filling in labels which are
+// present but empty such as the service label of the request metrics. A
+// label a collector set itself is left alone. The families of the inner
+// gatherer are copied first as collectors may hand out the same ones on
+// every scrape.
+func (l *labelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := l.gatherer.Gather()
+	out := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		metrics := make([]*dto.Metric, 0, len(family.GetMetric()))
+		for _, m := range family.GetMetric() {
+			metrics = append(metrics, &dto.Metric{
+				Label:       addLabels(m.GetLabel(), l.labels),
+				Gauge:       m.Gauge,
+				Counter:     m.Counter,
+				Summary:     m.Summary,
+				Untyped:     m.Untyped,
+				Histogram:   m.Histogram,
+				TimestampMs: m.TimestampMs,
+			})
+		}
+		out = append(out, &dto.MetricFamily{
+			Name:   family.Name,
+			Help:   family.Help,
+			Type:   family.Type,
+			Metric: metrics,
+		})
+	}
+	return out, err
+}
+
+func addLabels(pairs []*dto.LabelPair, labels prometheus.Labels) []*dto.LabelPair {
+	out := make([]*dto.LabelPair, 0, len(pairs)+len(labels))
+	seen := make(map[string]bool, len(pairs)+len(labels))
+	for _, pair := range pairs {
+		if seen[pair.GetName()] {
+			continue
+		}
+		seen[pair.GetName()] = true
+
+		if value, ok := labels[pair.GetName()]; ok && pair.GetValue() == "" {
+			pair = &dto.LabelPair{Name: pair.Name, Value: &value}
+		}
+		out = append(out, pair)
+	}
+
+	for name, value := range labels {
+		if seen[name] {
+			continue
+		}
+		name, value := name, value
+		out = append(out, &dto.LabelPair{Name: &name, Value: &value})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].GetName() < out[j].GetName()
+	})
+	return out
+}
+
+// NewGatherer gathers the default registry, which holds the template, Go
+// runtime and process metrics, along with the given gatherers and labels
+// everything with the service labels.
+func NewGatherer(cfg *config.Config, gatherers ...prometheus.Gatherer) prometheus.Gatherer {
+	return &labelGatherer{
+		gatherer: append(prometheus.Gatherers{prometheus.DefaultGatherer}, gatherers...),
+		labels:   ServiceLabels(cfg),
+	}
+}
@@ -0,0 +1,75 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/metrics"
+)
+
+func pair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
+
+func labels(m *dto.Metric) map[string][]string {
+	out := make(map[string][]string)
+	for _, pair := range m.GetLabel() {
+		out[pair.GetName()] = append(out[pair.GetName()], pair.GetValue())
+	}
+	return out
+}
+
+func TestGathererLabels(t *testing.T) {
+	// the same family every time, the way a caching collector would.
+	family := &dto.MetricFamily{
+		Name: proto.String("calls_total"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{
+			{Label: []*dto.LabelPair{pair("service", "")}, Counter: &dto.Counter{Value: proto.Float64(1)}},
+			{Label: []*dto.LabelPair{pair("service", "payments")}, Counter: &dto.Counter{Value: proto.Float64(2)}},
+		},
+	}
+	inner := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{family}, nil
+	})
+	g := metrics.NewGatherer(&config.Config{ServiceName: "orders", Environment: "test"}, inner)
+
+	for i := 0; i < 2; i++ {
+		families, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calls *dto.MetricFamily
+		for _, f := range families {
+			if f.GetName() == "calls_total" {
+				calls = f
+			}
+		}
+		if calls == nil {
+			t.Fatal("calls_total not gathered")
+		}
+
+		for m, service := range []string{"orders", "payments"} {
+			got := labels(calls.GetMetric()[m])
+			if len(got["service"]) != 1 || got["service"][0] != service {
+				t.Errorf("gather %d: service = %v, want %s", i, got["service"], service)
+			}
+			if len(got["environment"]) != 1 || got["environment"][0] != "test" {
+				t.Errorf("gather %d: environment = %v", i, got["environment"])
+			}
+		}
+	}
+
+	for _, m := range family.GetMetric() {
+		if len(m.GetLabel()) != 1 {
+			t.Errorf("inner family changed: %v", m.GetLabel())
+		}
+	}
+	if got := family.GetMetric()[0].GetLabel()[0].GetValue(); got != "" {
+		t.Errorf("inner label filled in: %q", got)
+	}
+}
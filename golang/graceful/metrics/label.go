@@ -0,0 +1,44 @@
+package metrics
+
+import "sync"
+
+// BoundedLabel keeps a label to at most max distinct values so a label fed
+// from requests, e.g. a route or a host, can't grow the series without
+// end. Values past the limit become other, a max of 0 is unbounded.
+type BoundedLabel struct {
+	max   int
+	other string
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+// Label returns the value, or other once the limit has been reached with
+// different values.
+func (b *BoundedLabel) Label(value string) string {
+	b.mu.RLock()
+	_, seen := b.seen[value]
+	b.mu.RUnlock()
+	if seen {
+		return value
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, seen := b.seen[value]; seen {
+		return value
+	}
+	if b.max > 0 && len(b.seen) >= b.max {
+		return b.other
+	}
+	b.seen[value] = struct{}{}
+	return value
+}
+
+func NewBoundedLabel(max int, other string) *BoundedLabel {
+	return &BoundedLabel{
+		max:   max,
+		other: other,
+		seen:  make(map[string]struct{}),
+	}
+}
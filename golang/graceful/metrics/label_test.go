@@ -0,0 +1,35 @@
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/contextcloud/graceful/metrics"
+)
+
+func TestBoundedLabel(t *testing.T) {
+	hosts := metrics.NewBoundedLabel(2, "other")
+
+	for _, host := range []string{"a.example", "b.example", "a.example"} {
+		if got := hosts.Label(host); got != host {
+			t.Errorf("Label(%q) = %q", host, got)
+		}
+	}
+	if got := hosts.Label("c.example"); got != "other" {
+		t.Errorf("past the limit got %q, want other", got)
+	}
+	// values seen before the limit keep their label.
+	if got := hosts.Label("b.example"); got != "b.example" {
+		t.Errorf("Label(b.example) = %q", got)
+	}
+}
+
+func TestBoundedLabelUnbounded(t *testing.T) {
+	hosts := metrics.NewBoundedLabel(0, "other")
+	for i := 0; i < 1000; i++ {
+		host := fmt.Sprintf("%d.example", i)
+		if got := hosts.Label(host); got != host {
+			t.Fatalf("Label(%q) = %q", host, got)
+		}
+	}
+}
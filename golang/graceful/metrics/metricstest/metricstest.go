@@ -0,0 +1,108 @@
+// Package metricstest has helpers for asserting on the metrics a function
+// registers.
+package metricstest
+
+import (
+	"context"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/metrics"
+)
+
+// NewRegistry returns a registry named like the function would be in
+// production.
+func NewRegistry(t testing.TB, serviceName string) *metrics.Registry {
+	t.Helper()
+	return metrics.NewRegistry(&config.Config{
+		Environment: "test",
+		ServiceName: serviceName,
+		Version:     "test",
+	})
+}
+
+// NewContext returns a context carrying a fresh registry, ready to be passed
+// to function.NewHandler.
+func NewContext(t testing.TB, serviceName string) (context.Context, *metrics.Registry) {
+	t.Helper()
+	r := NewRegistry(t, serviceName)
+	return metrics.WithRegistry(context.Background(), r), r
+}
+
+// Value returns the value of a counter or gauge. The name is given without
+// the service prefix and labels are name, value pairs which must all match.
+func Value(t testing.TB, r *metrics.Registry, name string, labels ...string) float64 {
+	t.Helper()
+	m := find(t, r, name, labels)
+	switch {
+	case m.GetCounter() != nil:
+		return m.GetCounter().GetValue()
+	case m.GetGauge() != nil:
+		return m.GetGauge().GetValue()
+	case m.GetUntyped() != nil:
+		return m.GetUntyped().GetValue()
+	default:
+		t.Fatalf("metric %s is not a counter or gauge", r.Name(name))
+		return 0
+	}
+}
+
+// SampleCount returns the number of observations of a histogram or summary.
+func SampleCount(t testing.TB, r *metrics.Registry, name string, labels ...string) uint64 {
+	t.Helper()
+	m := find(t, r, name, labels)
+	switch {
+	case m.GetHistogram() != nil:
+		return m.GetHistogram().GetSampleCount()
+	case m.GetSummary() != nil:
+		return m.GetSummary().GetSampleCount()
+	default:
+		t.Fatalf("metric %s is not a histogram or summary", r.Name(name))
+		return 0
+	}
+}
+
+func find(t testing.TB, r *metrics.Registry, name string, labels []string) *dto.Metric {
+	t.Helper()
+	if len(labels)%2 != 0 {
+		t.Fatalf("labels must be name, value pairs: %v", labels)
+	}
+
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+
+	full := r.Name(name)
+	for _, family := range families {
+		if family.GetName() != full {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if matches(m, labels) {
+				return m
+			}
+		}
+	}
+
+	t.Fatalf("metric %s%v not found", full, labels)
+	return nil
+}
+
+func matches(m *dto.Metric, labels []string) bool {
+	for i := 0; i < len(labels); i += 2 {
+		found := false
+		for _, pair := range m.GetLabel() {
+			if pair.GetName() == labels[i] && pair.GetValue() == labels[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
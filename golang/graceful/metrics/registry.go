@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// Registry holds the metrics registered by a function. Every metric is
+// prefixed with the service name and labelled with the environment and
+// version so functions can't collide with each other or with the template.
+type Registry struct {
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+	prefix     string
+}
+
+// Registerer returns the registerer functions should register their own
+// collectors with.
+func (r *Registry) Registerer() prometheus.Registerer {
+	return r.registerer
+}
+
+// Gather implements prometheus.Gatherer so the registry can be served by the
+// metrics server.
+func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
+	return r.registry.Gather()
+}
+
+// Name returns the full name a metric is exposed under.
+func (r *Registry) Name(name string) string {
+	return r.prefix + name
+}
+
+func (r *Registry) Register(c prometheus.Collector) error {
+	return r.registerer.Register(c)
+}
+
+func (r *Registry) MustRegister(cs ...prometheus.Collector) {
+	r.registerer.MustRegister(cs...)
+}
+
+// NewCounter registers a counter, returning the existing one when another
+// package already registered the same counter.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	return register(r, c).(*prometheus.CounterVec)
+}
+
+// NewGauge registers a gauge, returning the existing one when another
+// package already registered the same gauge.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *prometheus.GaugeVec {
+	c := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	return register(r, c).(*prometheus.GaugeVec)
+}
+
+// NewHistogram registers a histogram, returning the existing one when another
+// package already registered the same histogram. Nil buckets uses the
+// prometheus defaults.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	c := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	return register(r, c).(*prometheus.HistogramVec)
+}
+
+func register(r *Registry, c prometheus.Collector) prometheus.Collector {
+	if err := r.registerer.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(fmt.Errorf("register metric: %w", err))
+	}
+	return c
+}
+
+// Namespace turns a service name into a valid metric name prefix.
+func Namespace(serviceName string) string {
+	var sb strings.Builder
+	for i, r := range strings.ToLower(serviceName) {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+func NewRegistry(cfg *config.Config) *Registry {
+	registry := prometheus.NewRegistry()
+
+	prefix := ""
+	if ns := Namespace(cfg.ServiceName); ns != "" {
+		prefix = ns + "_"
+	}
+
+	labels := prometheus.Labels{
+		"environment": cfg.Environment,
+		"version":     cfg.Version,
+	}
+
+	return &Registry{
+		registry:   registry,
+		registerer: prometheus.WrapRegistererWithPrefix(prefix, prometheus.WrapRegistererWith(labels, registry)),
+		prefix:     prefix,
+	}
+}
@@ -0,0 +1,66 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/contextcloud/graceful/metrics"
+	"github.com/contextcloud/graceful/metrics/metricstest"
+)
+
+func TestNamespace(t *testing.T) {
+	tests := map[string]string{
+		"orders":       "orders",
+		"Order-Events": "order_events",
+		"3d-render":    "_3d_render",
+		"svc.v2":       "svc_v2",
+	}
+	for in, want := range tests {
+		if got := metrics.Namespace(in); got != want {
+			t.Errorf("Namespace(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ctx, r := metricstest.NewContext(t, "orders")
+	if metrics.FromContext(ctx) != r {
+		t.Fatal("registry not in the context")
+	}
+
+	placed := metrics.FromContext(ctx).NewCounter("placed_total", "Orders placed.", "kind")
+	placed.WithLabelValues("online").Add(2)
+
+	// registering the same counter again hands back the first one.
+	again := r.NewCounter("placed_total", "Orders placed.", "kind")
+	again.WithLabelValues("online").Inc()
+
+	if got := metricstest.Value(t, r, "placed_total", "kind", "online", "environment", "test"); got != 3 {
+		t.Errorf("placed_total = %v, want 3", got)
+	}
+	if got := r.Name("placed_total"); got != "orders_placed_total" {
+		t.Errorf("Name() = %q", got)
+	}
+
+	latency := r.NewHistogram("latency_seconds", "Latency.", nil)
+	latency.WithLabelValues().Observe(0.1)
+	if got := metricstest.SampleCount(t, r, "latency_seconds"); got != 1 {
+		t.Errorf("latency_seconds count = %v, want 1", got)
+	}
+}
+
+func TestFromContextWithoutRegistry(t *testing.T) {
+	c := func() prometheus.Collector {
+		return prometheus.NewCounter(prometheus.CounterOpts{Name: "calls_total", Help: "Calls."})
+	}
+
+	// unrelated callers without a registry mustn't collide.
+	if err := metrics.FromContext(context.Background()).Register(c()); err != nil {
+		t.Fatal(err)
+	}
+	if err := metrics.FromContext(context.Background()).Register(c()); err != nil {
+		t.Errorf("second registration: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package platform
+
+import (
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// FaaSNamespaceKey has no semantic convention yet.
+const FaaSNamespaceKey = attribute.Key("faas.namespace")
+
+// The environment variables each field is read from, the first one set
+// wins. Pod fields are expected from the downward API, e.g.
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom:
+//	    fieldRef:
+//	      fieldPath: metadata.name
+var (
+	podNameEnv           = []string{"K8S_POD_NAME", "POD_NAME"}
+	podNamespaceEnv      = []string{"K8S_NAMESPACE_NAME", "POD_NAMESPACE"}
+	podUIDEnv            = []string{"K8S_POD_UID", "POD_UID"}
+	nodeNameEnv          = []string{"K8S_NODE_NAME", "NODE_NAME"}
+	containerNameEnv     = []string{"K8S_CONTAINER_NAME", "CONTAINER_NAME"}
+	functionNameEnv      = []string{"OPENFAAS_NAME", "FUNCTION_NAME"}
+	functionNamespaceEnv = []string{"OPENFAAS_NAMESPACE", "FUNCTION_NAMESPACE"}
+)
+
+// Metadata is what the process knows about the pod and the function it
+// runs as.
+type Metadata struct {
+	PodName           string `json:"podName,omitempty"`
+	PodNamespace      string `json:"podNamespace,omitempty"`
+	PodUID            string `json:"podUid,omitempty"`
+	NodeName          string `json:"nodeName,omitempty"`
+	ContainerName     string `json:"containerName,omitempty"`
+	FunctionName      string `json:"functionName,omitempty"`
+	FunctionNamespace string `json:"functionNamespace,omitempty"`
+}
+
+// InKubernetes reports whether any pod metadata was found.
+func (m Metadata) InKubernetes() bool {
+	return m.PodName != "" || m.PodNamespace != ""
+}
+
+// K8sAttributes are the k8s.* resource attributes.
+func (m Metadata) K8sAttributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	add := func(key attribute.Key, value string) {
+		if value != "" {
+			attrs = append(attrs, key.String(value))
+		}
+	}
+	add(semconv.K8SPodNameKey, m.PodName)
+	add(semconv.K8SNamespaceNameKey, m.PodNamespace)
+	add(semconv.K8SPodUIDKey, m.PodUID)
+	add(semconv.K8SNodeNameKey, m.NodeName)
+	add(semconv.K8SContainerNameKey, m.ContainerName)
+	return attrs
+}
+
+// FaaSAttributes are the faas.* resource attributes.
+func (m Metadata) FaaSAttributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if m.FunctionName != "" {
+		attrs = append(attrs, semconv.FaaSNameKey.String(m.FunctionName))
+	}
+	if m.FunctionNamespace != "" {
+		attrs = append(attrs, FaaSNamespaceKey.String(m.FunctionNamespace))
+	}
+	return attrs
+}
+
+func lookup(getenv func(string) string, names []string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(getenv(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// FromEnv reads the metadata from the environment only.
+func FromEnv(getenv func(string) string) Metadata {
+	return Metadata{
+		PodName:           lookup(getenv, podNameEnv),
+		PodNamespace:      lookup(getenv, podNamespaceEnv),
+		PodUID:            lookup(getenv, podUIDEnv),
+		NodeName:          lookup(getenv, nodeNameEnv),
+		ContainerName:     lookup(getenv, containerNameEnv),
+		FunctionName:      lookup(getenv, functionNameEnv),
+		FunctionNamespace: lookup(getenv, functionNamespaceEnv),
+	}
+}
+
+// Detect reads the metadata from the environment. In a pod without the
+// downward API the hostname and service account fill in the pod name and
+// namespace.
+func Detect() Metadata {
+	m := FromEnv(os.Getenv)
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return m
+	}
+
+	if m.PodName == "" {
+		m.PodName, _ = os.Hostname()
+	}
+	if m.PodNamespace == "" {
+		if ns, err := os.ReadFile(serviceAccountNamespace); err == nil {
+			m.PodNamespace = strings.TrimSpace(string(ns))
+		}
+	}
+	return m
+}
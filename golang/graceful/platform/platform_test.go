@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env  map[string]string
+		want Metadata
+	}{
+		"nothing": {},
+		"downward api": {
+			env: map[string]string{
+				"POD_NAME":       "orders-7d9f-x2",
+				"POD_NAMESPACE":  "shop",
+				"POD_UID":        "3c1e",
+				"NODE_NAME":      "node-1",
+				"CONTAINER_NAME": "orders",
+			},
+			want: Metadata{
+				PodName:       "orders-7d9f-x2",
+				PodNamespace:  "shop",
+				PodUID:        "3c1e",
+				NodeName:      "node-1",
+				ContainerName: "orders",
+			},
+		},
+		"k8s names win": {
+			env: map[string]string{
+				"K8S_POD_NAME":       "from-k8s",
+				"POD_NAME":           "from-pod",
+				"K8S_NAMESPACE_NAME": "k8s-ns",
+				"POD_NAMESPACE":      "pod-ns",
+			},
+			want: Metadata{PodName: "from-k8s", PodNamespace: "k8s-ns"},
+		},
+		"openfaas": {
+			env: map[string]string{
+				"OPENFAAS_NAME":      "orders",
+				"OPENFAAS_NAMESPACE": "openfaas-fn",
+				"FUNCTION_NAME":      "other",
+			},
+			want: Metadata{FunctionName: "orders", FunctionNamespace: "openfaas-fn"},
+		},
+		"function fallbacks": {
+			env: map[string]string{
+				"FUNCTION_NAME":      "orders",
+				"FUNCTION_NAMESPACE": "fn",
+			},
+			want: Metadata{FunctionName: "orders", FunctionNamespace: "fn"},
+		},
+		"blank values skipped": {
+			env: map[string]string{
+				"K8S_POD_NAME": "  ",
+				"POD_NAME":     " orders ",
+			},
+			want: Metadata{PodName: "orders"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := FromEnv(func(key string) string { return tt.env[key] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	m := Metadata{PodName: "orders-1", NodeName: "node-1", FunctionName: "orders"}
+	if got := len(m.K8sAttributes()); got != 2 {
+		t.Errorf("%d k8s attributes, want 2", got)
+	}
+	if got := len(m.FaaSAttributes()); got != 1 {
+		t.Errorf("%d faas attributes, want 1", got)
+	}
+	if !m.InKubernetes() {
+		t.Error("not in kubernetes with a pod name")
+	}
+	if (Metadata{FunctionName: "orders"}).InKubernetes() {
+		t.Error("in kubernetes without pod metadata")
+	}
+}
@@ -2,12 +2,13 @@ package graceful
 
 import (
 	"context"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"go.uber.org/zap"
+
 	"github.com/contextcloud/graceful/srv"
 )
 
@@ -22,18 +23,19 @@ func Run(ctx context.Context, s srv.Startable) {
 		<-sig
 
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, shutdownCancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer shutdownCancel()
 
 		go func() {
 			<-shutdownCtx.Done()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
-				log.Fatal("graceful shutdown timed out.. forcing exit.")
+				zap.L().Fatal("graceful shutdown timed out.. forcing exit.")
 			}
 		}()
 
 		// Trigger graceful shutdown
 		if err := s.Shutdown(shutdownCtx); err != nil {
-			log.Print(err)
+			zap.L().Error("shutdown failed", zap.Error(err))
 		}
 
 		serverStopCtx()
@@ -0,0 +1,291 @@
+package slo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// burnWindows are the windows used for multi-window burn rate alerts, pair
+// a long window with a short one to page quickly without flapping.
+var burnWindows = []time.Duration{
+	5 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+}
+
+var (
+	objectiveDesc = prometheus.NewDesc(
+		"slo_objective_ratio",
+		"Target ratio of good requests.",
+		[]string{"slo"}, nil,
+	)
+	burnRateDesc = prometheus.NewDesc(
+		"slo_burn_rate",
+		"Rate the error budget is being spent over the window, 1 spends it exactly by the end of the SLO window.",
+		[]string{"slo", "window"}, nil,
+	)
+	budgetDesc = prometheus.NewDesc(
+		"slo_error_budget_remaining_ratio",
+		"Fraction of the error budget left over the SLO window.",
+		[]string{"slo"}, nil,
+	)
+	requestsDesc = prometheus.NewDesc(
+		"slo_requests",
+		"Requests seen over the SLO window.",
+		[]string{"slo", "result"}, nil,
+	)
+)
+
+type counts struct {
+	total  uint64
+	errors uint64
+	slow   uint64
+}
+
+func (c *counts) add(o counts) {
+	c.total += o.total
+	c.errors += o.errors
+	c.slow += o.slow
+}
+
+func (c *counts) sub(o counts) {
+	c.total -= o.total
+	c.errors -= o.errors
+	c.slow -= o.slow
+}
+
+// bucket counts the requests seen in one minute.
+type bucket struct {
+	minute int64
+	counts
+}
+
+// window keeps the running counts of the last minutes, so a scrape doesn't
+// have to add up the buckets.
+type window struct {
+	minutes int64
+	sum     counts
+}
+
+type objective struct {
+	name   string
+	target float64
+	bad    func(c counts) uint64
+}
+
+// Report is the state of one objective for the health report.
+type Report struct {
+	Name            string             `json:"name"`
+	Target          float64            `json:"target"`
+	Total           uint64             `json:"total"`
+	Bad             uint64             `json:"bad"`
+	BudgetRemaining float64            `json:"budgetRemaining"`
+	BurnRates       map[string]float64 `json:"burnRates"`
+}
+
+// Tracker keeps a rolling count of good and bad requests per minute over
+// the SLO window, along with running totals for the burn rate windows and
+// the SLO window which are kept up to date as the minutes go by.
+type Tracker struct {
+	cfg        config.SLOConfig
+	objectives []objective
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets []bucket
+	// windows are the burn rate windows followed by the SLO window.
+	windows []window
+	current int64
+}
+
+func (t *Tracker) ObserveHTTPRequestDuration(_ context.Context, props httpmetrics.HTTPReqProperties, duration time.Duration) {
+	if len(t.objectives) == 0 {
+		return
+	}
+
+	c := counts{total: 1}
+	if strings.HasPrefix(props.Code, "5") {
+		c.errors = 1
+	}
+	if t.cfg.Latency > 0 && duration > t.cfg.Latency {
+		c.slow = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.advance(t.now().Unix() / 60)
+	t.buckets[t.current%int64(len(t.buckets))].add(c)
+	for i := range t.windows {
+		t.windows[i].sum.add(c)
+	}
+}
+
+func (t *Tracker) ObserveHTTPResponseSize(context.Context, httpmetrics.HTTPReqProperties, int64) {}
+
+func (t *Tracker) AddInflightRequests(context.Context, httpmetrics.HTTPProperties, int) {}
+
+// advance moves the windows on to the minute, taking out the minutes which
+// fell out of each of them. After a gap longer than the SLO window nothing
+// is left.
+func (t *Tracker) advance(minute int64) {
+	if minute <= t.current {
+		return
+	}
+	if minute-t.current >= int64(len(t.buckets)) {
+		for i := range t.buckets {
+			t.buckets[i] = bucket{}
+		}
+		for i := range t.windows {
+			t.windows[i].sum = counts{}
+		}
+		t.current = minute
+		t.buckets[minute%int64(len(t.buckets))].minute = minute
+		return
+	}
+
+	for m := t.current + 1; m <= minute; m++ {
+		for i := range t.windows {
+			w := &t.windows[i]
+			old := &t.buckets[(m-w.minutes)%int64(len(t.buckets))]
+			if old.minute == m-w.minutes {
+				w.sum.sub(old.counts)
+			}
+		}
+		t.buckets[m%int64(len(t.buckets))] = bucket{minute: m}
+	}
+	t.current = minute
+}
+
+func (o objective) burnRate(total uint64, bad uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return (float64(bad) / float64(total)) / (1 - o.target)
+}
+
+// Report returns the state of every objective.
+func (t *Tracker) Report() []Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.windows) == 0 {
+		return nil
+	}
+	t.advance(t.now().Unix() / 60)
+
+	burn, slo := t.windows[:len(t.windows)-1], t.windows[len(t.windows)-1]
+	out := make([]Report, 0, len(t.objectives))
+	for _, o := range t.objectives {
+		total, bad := slo.sum.total, o.bad(slo.sum)
+		r := Report{
+			Name:            o.name,
+			Target:          o.target,
+			Total:           total,
+			Bad:             bad,
+			BudgetRemaining: 1 - o.burnRate(total, bad),
+			BurnRates:       make(map[string]float64, len(burn)),
+		}
+		for _, w := range burn {
+			r.BurnRates[windowLabel(time.Duration(w.minutes)*time.Minute)] = o.burnRate(w.sum.total, o.bad(w.sum))
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- objectiveDesc
+	ch <- burnRateDesc
+	ch <- budgetDesc
+	ch <- requestsDesc
+}
+
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	for _, r := range t.Report() {
+		ch <- prometheus.MustNewConstMetric(objectiveDesc, prometheus.GaugeValue, r.Target, r.Name)
+		ch <- prometheus.MustNewConstMetric(budgetDesc, prometheus.GaugeValue, r.BudgetRemaining, r.Name)
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.GaugeValue, float64(r.Total-r.Bad), r.Name, "good")
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.GaugeValue, float64(r.Bad), r.Name, "bad")
+		for window, rate := range r.BurnRates {
+			ch <- prometheus.MustNewConstMetric(burnRateDesc, prometheus.GaugeValue, rate, r.Name, window)
+		}
+	}
+}
+
+func windowLabel(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+func validTarget(target float64) bool {
+	return target > 0 && target < 1
+}
+
+// NewTracker builds a tracker for the configured objectives and registers
+// its metrics. With no objectives configured it records nothing.
+func NewTracker(cfg config.SLOConfig) (*Tracker, error) {
+	if cfg.Window < time.Minute {
+		return nil, fmt.Errorf("slo window must be at least a minute: %s", cfg.Window)
+	}
+
+	t := &Tracker{
+		cfg: cfg,
+		now: time.Now,
+	}
+
+	if cfg.Availability != 0 {
+		if !validTarget(cfg.Availability) {
+			return nil, fmt.Errorf("slo availability must be between 0 and 1: %v", cfg.Availability)
+		}
+		t.objectives = append(t.objectives, objective{
+			name:   "availability",
+			target: cfg.Availability,
+			bad:    func(c counts) uint64 { return c.errors },
+		})
+	}
+	if cfg.Latency > 0 {
+		if !validTarget(cfg.LatencyTarget) {
+			return nil, fmt.Errorf("slo latency target must be between 0 and 1: %v", cfg.LatencyTarget)
+		}
+		t.objectives = append(t.objectives, objective{
+			name:   "latency",
+			target: cfg.LatencyTarget,
+			bad:    func(c counts) uint64 { return c.slow },
+		})
+	}
+
+	if len(t.objectives) == 0 {
+		return t, nil
+	}
+
+	for _, w := range burnWindows {
+		if w <= cfg.Window {
+			t.windows = append(t.windows, window{minutes: int64(w / time.Minute)})
+		}
+	}
+	t.windows = append(t.windows, window{minutes: int64(cfg.Window / time.Minute)})
+	t.buckets = make([]bucket, cfg.Window/time.Minute)
+
+	if err := prometheus.Register(t); err != nil {
+		return nil, fmt.Errorf("register slo metrics: %w", err)
+	}
+	return t, nil
+}
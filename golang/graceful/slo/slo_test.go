@@ -0,0 +1,66 @@
+package slo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestTrackerWindows(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	tracker, err := NewTracker(config.SLOConfig{Availability: 0.99, Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.now = func() time.Time { return now }
+
+	observe := func(n int, code string) {
+		for i := 0; i < n; i++ {
+			tracker.ObserveHTTPRequestDuration(context.Background(), httpmetrics.HTTPReqProperties{Code: code}, time.Millisecond)
+		}
+	}
+	report := func() Report {
+		t.Helper()
+		reports := tracker.Report()
+		if len(reports) != 1 {
+			t.Fatalf("got %d reports", len(reports))
+		}
+		return reports[0]
+	}
+
+	observe(99, "200")
+	observe(1, "500")
+	now = now.Add(10 * time.Minute)
+	observe(100, "200")
+
+	r := report()
+	if r.Total != 200 || r.Bad != 1 {
+		t.Errorf("total, bad = %d, %d, want 200, 1", r.Total, r.Bad)
+	}
+	if rate := r.BurnRates["5m"]; rate != 0 {
+		t.Errorf("5m burn rate = %v, want 0", rate)
+	}
+	if rate := r.BurnRates["30m"]; rate < 0.499 || rate > 0.501 {
+		t.Errorf("30m burn rate = %v, want 0.5", rate)
+	}
+
+	// the first minute leaves the hour.
+	now = now.Add(50 * time.Minute)
+	if r := report(); r.Total != 100 || r.Bad != 0 {
+		t.Errorf("after an hour total, bad = %d, %d, want 100, 0", r.Total, r.Bad)
+	}
+
+	// a long quiet spell empties everything.
+	now = now.Add(3 * time.Hour)
+	if r := report(); r.Total != 0 || r.BudgetRemaining != 1 {
+		t.Errorf("after a gap total = %d, budget = %v", r.Total, r.BudgetRemaining)
+	}
+	observe(1, "500")
+	if r := report(); r.Total != 1 || r.Bad != 1 {
+		t.Errorf("after the gap total, bad = %d, %d, want 1, 1", r.Total, r.Bad)
+	}
+}
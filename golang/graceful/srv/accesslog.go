@@ -0,0 +1,350 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// accessEntry is everything known about a finished request.
+type accessEntry struct {
+	start     time.Time
+	duration  time.Duration
+	r         *http.Request
+	route     string
+	status    int
+	size      int64
+	requestID string
+	remoteIP  string
+	span      trace.SpanContext
+}
+
+// trustedProxies are the addresses whose X-Forwarded-For is believed.
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(addrs []string) (trustedProxies, error) {
+	var out trustedProxies
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if strings.Contains(addr, "/") {
+			_, network, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy: %w", err)
+			}
+			out = append(out, network)
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("trusted proxy: invalid address %q", addr)
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return out, nil
+}
+
+func (p trustedProxies) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP is the address of the client. X-Forwarded-For is only read when
+// the request came through a trusted proxy, and then the client is the
+// last hop which isn't a trusted proxy as anything before it can be made
+// up by the client.
+func remoteIP(r *http.Request, proxies trustedProxies) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !proxies.trusts(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !proxies.trusts(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatCombined is the Apache combined log format.
+func formatCombined(e *accessEntry) []byte {
+	user := "-"
+	if u, _, ok := e.r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	return []byte(fmt.Sprintf("%s - %s [%s] %q %d %d %q %q\n",
+		e.remoteIP,
+		user,
+		e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.r.Method+" "+e.r.RequestURI+" "+e.r.Proto,
+		e.status,
+		e.size,
+		orDash(e.r.Referer()),
+		orDash(e.r.UserAgent()),
+	))
+}
+
+type jsonAccessEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status"`
+	Size      int64     `json:"size"`
+	Duration  float64   `json:"duration_ms"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	SpanID    string    `json:"span_id,omitempty"`
+}
+
+func formatJSON(e *accessEntry) ([]byte, error) {
+	out := jsonAccessEntry{
+		Time:      e.start.UTC(),
+		Method:    e.r.Method,
+		Path:      e.r.URL.Path,
+		Route:     e.route,
+		Status:    e.status,
+		Size:      e.size,
+		Duration:  float64(e.duration) / float64(time.Millisecond),
+		RemoteIP:  e.remoteIP,
+		UserAgent: e.r.UserAgent(),
+		Referer:   e.r.Referer(),
+		RequestID: e.requestID,
+	}
+	if e.span.IsValid() {
+		out.TraceID = e.span.TraceID().String()
+		out.SpanID = e.span.SpanID().String()
+	}
+	return json.Marshal(out)
+}
+
+// gcpHTTPRequest is the httpRequest field of a Cloud Logging entry.
+type gcpHTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	Status        int    `json:"status"`
+	ResponseSize  string `json:"responseSize"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol"`
+}
+
+type gcpAccessEntry struct {
+	Severity     string         `json:"severity"`
+	Message      string         `json:"message"`
+	Time         time.Time      `json:"time"`
+	HTTPRequest  gcpHTTPRequest `json:"httpRequest"`
+	RequestID    string         `json:"request_id,omitempty"`
+	Trace        string         `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID       string         `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled bool           `json:"logging.googleapis.com/trace_sampled,omitempty"`
+}
+
+func gcpSeverity(status int) string {
+	switch {
+	case status >= 500:
+		return "ERROR"
+	case status >= 400:
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
+
+// formatGCP writes the structured format Cloud Logging turns into a request
+// log linked to its trace.
+func formatGCP(projectID string) func(e *accessEntry) ([]byte, error) {
+	return func(e *accessEntry) ([]byte, error) {
+		out := gcpAccessEntry{
+			Severity: gcpSeverity(e.status),
+			Message:  fmt.Sprintf("%s %s %d", e.r.Method, e.r.URL.Path, e.status),
+			Time:     e.start.UTC(),
+			HTTPRequest: gcpHTTPRequest{
+				RequestMethod: e.r.Method,
+				RequestURL:    e.r.RequestURI,
+				Status:        e.status,
+				ResponseSize:  strconv.FormatInt(e.size, 10),
+				UserAgent:     e.r.UserAgent(),
+				RemoteIP:      e.remoteIP,
+				Referer:       e.r.Referer(),
+				Latency:       fmt.Sprintf("%.9fs", e.duration.Seconds()),
+				Protocol:      e.r.Proto,
+			},
+			RequestID: e.requestID,
+		}
+		if e.r.ContentLength > 0 {
+			out.HTTPRequest.RequestSize = strconv.FormatInt(e.r.ContentLength, 10)
+		}
+		if e.span.IsValid() {
+			if projectID != "" {
+				out.Trace = "projects/" + projectID + "/traces/" + e.span.TraceID().String()
+			}
+			out.SpanID = e.span.SpanID().String()
+			out.TraceSampled = e.span.IsSampled()
+		}
+		return json.Marshal(out)
+	}
+}
+
+func newAccessFormat(cfg *config.Config) (func(e *accessEntry) ([]byte, error), error) {
+	switch cfg.AccessLog.Format {
+	case "combined":
+		return func(e *accessEntry) ([]byte, error) { return formatCombined(e), nil }, nil
+	case "", "json":
+		return formatJSON, nil
+	case "gcp":
+		return formatGCP(cfg.Tracing.ProjectId), nil
+	default:
+		return nil, fmt.Errorf("unknown access log format: %s", cfg.AccessLog.Format)
+	}
+}
+
+type accessLog struct {
+	format   func(e *accessEntry) ([]byte, error)
+	excluded map[string]struct{}
+	ratios   map[string]float64
+	proxies  trustedProxies
+
+	// a broken format or stdout would otherwise log on every request.
+	formatFailed sync.Once
+	writeFailed  sync.Once
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// sampled keeps every failed request and a ratio of the rest on routes
+// with a rule.
+func (l *accessLog) sampled(route string, status int) bool {
+	ratio, ok := l.ratios[route]
+	if !ok || status >= 500 {
+		return true
+	}
+	return rand.Float64() < ratio
+}
+
+func (l *accessLog) write(e *accessEntry) {
+	line, err := l.format(e)
+	if err != nil {
+		l.formatFailed.Do(func() {
+			zap.L().Warn("access log: format failed, later failures aren't logged", zap.Error(err))
+		})
+		return
+	}
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		l.writeFailed.Do(func() {
+			zap.L().Warn("access log: write failed, later failures aren't logged", zap.Error(err))
+		})
+	}
+}
+
+// WithAccessLog writes a line per request to stdout in the configured
+// format, skipping excluded paths and sampling busy routes.
+func WithAccessLog(cfg *config.Config, h http.Handler) (http.Handler, error) {
+	if !cfg.AccessLog.Enabled {
+		return h, nil
+	}
+
+	format, err := newAccessFormat(cfg)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := parseTrustedProxies(cfg.AccessLog.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &accessLog{
+		format:   format,
+		proxies:  proxies,
+		excluded: make(map[string]struct{}, len(cfg.AccessLog.ExcludedPaths)),
+		ratios:   make(map[string]float64, len(cfg.AccessLog.Rules)),
+		w:        os.Stdout,
+	}
+	for _, path := range cfg.AccessLog.ExcludedPaths {
+		l.excluded[path] = struct{}{}
+	}
+	for _, rule := range cfg.AccessLog.Rules {
+		l.ratios[rule.Route] = rule.Ratio
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := l.excluded[r.URL.Path]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+
+		route := RouteFromContext(r.Context())
+		if !l.sampled(route, sw.status) {
+			return
+		}
+		l.write(&accessEntry{
+			start:     start,
+			duration:  time.Since(start),
+			r:         r,
+			route:     route,
+			status:    sw.status,
+			size:      sw.size,
+			requestID: w.Header().Get("X-Request-Id"),
+			remoteIP:  remoteIP(r, l.proxies),
+			span:      trace.SpanContextFromContext(r.Context()),
+		})
+	}), nil
+}
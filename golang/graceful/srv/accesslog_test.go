@@ -0,0 +1,119 @@
+package srv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRemoteIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		remoteAddr string
+		forwarded  []string
+		proxies    trustedProxies
+		want       string
+	}{
+		"direct": {
+			remoteAddr: "203.0.113.7:5123",
+			want:       "203.0.113.7",
+		},
+		"forwarded without trusted proxies": {
+			remoteAddr: "10.0.0.2:5123",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "10.0.0.2",
+		},
+		"forwarded by an untrusted client": {
+			remoteAddr: "203.0.113.7:5123",
+			forwarded:  []string{"198.51.100.1"},
+			proxies:    proxies,
+			want:       "203.0.113.7",
+		},
+		"through a trusted proxy": {
+			remoteAddr: "10.0.0.2:5123",
+			forwarded:  []string{"198.51.100.1"},
+			proxies:    proxies,
+			want:       "198.51.100.1",
+		},
+		"spoofed first hop": {
+			remoteAddr: "10.0.0.2:5123",
+			forwarded:  []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"},
+			proxies:    proxies,
+			want:       "198.51.100.1",
+		},
+		"several headers": {
+			remoteAddr: "[fd00::1]:5123",
+			forwarded:  []string{"1.1.1.1", "198.51.100.1"},
+			proxies:    proxies,
+			want:       "198.51.100.1",
+		},
+		"only proxies": {
+			remoteAddr: "10.0.0.2:5123",
+			forwarded:  []string{"10.0.0.3"},
+			proxies:    proxies,
+			want:       "10.0.0.3",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := remoteIP(r, tt.proxies); got != tt.want {
+				t.Errorf("remoteIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestAccessLogErrorsLoggedOnce(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	l := &accessLog{
+		format: func(e *accessEntry) ([]byte, error) {
+			if e.status == http.StatusTeapot {
+				return nil, errors.New("bad entry")
+			}
+			return formatJSON(e)
+		},
+		w: failingWriter{},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 3; i++ {
+		l.write(&accessEntry{start: time.Now(), r: r, status: http.StatusOK})
+		l.write(&accessEntry{start: time.Now(), r: r, status: http.StatusTeapot})
+	}
+
+	if got := logs.FilterMessageSnippet("write failed").Len(); got != 1 {
+		t.Errorf("write failure logged %d times", got)
+	}
+	if got := logs.FilterMessageSnippet("format failed").Len(); got != 1 {
+		t.Errorf("format failure logged %d times", got)
+	}
+}
@@ -0,0 +1,148 @@
+package srv
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/logging"
+)
+
+func readToken(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	token := bytes.TrimSpace(b)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	return token, nil
+}
+
+// withToken lets through requests carrying the bearer token. The secret is
+// read every time so a rotated token works without a restart.
+func withToken(file string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := readToken(file)
+		if err != nil {
+			zap.L().Error("admin: read token", zap.Error(err))
+			http.Error(w, "admin token unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if given == auth || subtle.ConstantTimeCompare([]byte(given), token) != 1 {
+			zap.L().Warn("admin: unauthorized request",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr),
+			)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type levelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+func (req levelRequest) ttl(cfg config.AdminConfig) (time.Duration, error) {
+	if req.TTL == "" {
+		return cfg.TTL, nil
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("ttl: %w", err)
+	}
+	if ttl <= 0 {
+		return 0, errors.New("ttl must be positive")
+	}
+	if cfg.MaxTTL > 0 && ttl > cfg.MaxTTL {
+		return 0, fmt.Errorf("ttl is over the maximum of %s", cfg.MaxTTL)
+	}
+	return ttl, nil
+}
+
+func writeLevels(w http.ResponseWriter, levels *logging.Levels) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(levels.State())
+}
+
+// logLevelHandler reports the levels on GET, sets one on PUT with a body
+// like {"logger": "httpclient", "level": "debug", "ttl": "10m"} and drops
+// the level of a named logger on DELETE with ?logger=httpclient. An empty
+// logger is the process level.
+func logLevelHandler(cfg config.AdminConfig, levels *logging.Levels) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who := []zap.Field{
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req levelRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("decode request: %v", err), http.StatusBadRequest)
+				return
+			}
+			level, err := zapcore.ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ttl, err := req.ttl(cfg)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			levels.Set(req.Logger, level, ttl, who...)
+		case http.MethodDelete:
+			name := r.URL.Query().Get("logger")
+			if name == "" {
+				http.Error(w, "logger is required", http.StatusBadRequest)
+				return
+			}
+			levels.Reset(name, who...)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeLevels(w, levels)
+	})
+}
+
+// NewAdmin serves the admin endpoints behind the token from the secret,
+// /loglevel to look at and change log levels at runtime. Without an
+// address it does nothing.
+func NewAdmin(cfg *config.Config, levels *logging.Levels) (Startable, error) {
+	if cfg.Admin.Addr == "" {
+		return NewNoop(), nil
+	}
+	if _, err := readToken(cfg.Admin.TokenFile); err != nil {
+		return nil, fmt.Errorf("admin token: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/loglevel", logLevelHandler(cfg.Admin, levels))
+	return NewStandard(cfg.Admin.Addr, withToken(cfg.Admin.TokenFile, mux)), nil
+}
@@ -0,0 +1,75 @@
+package srv
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	otelbaggage "go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/baggage"
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/metrics"
+)
+
+// OtherBaggageValue is the label of the values of a member which arrive
+// after MaxValues distinct values have been counted.
+const OtherBaggageValue = "other"
+
+var baggageRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_by_baggage_total",
+	Help: "Requests by the value of a configured baggage member.",
+}, []string{"member", "value", "code"})
+
+func init() {
+	prometheus.MustRegister(baggageRequests)
+}
+
+// WithBaggage picks the configured members out of the baggage extracted by
+// WithTracing, puts them on the span and in the context for logging, and
+// optionally counts requests by them.
+func WithBaggage(cfg *config.Config, h http.Handler) http.Handler {
+	members := cfg.Baggage.Members
+	if len(members) == 0 {
+		return h
+	}
+
+	labels := make(map[string]*metrics.BoundedLabel, len(members))
+	for _, member := range members {
+		labels[member] = metrics.NewBoundedLabel(cfg.Baggage.MaxValues, OtherBaggageValue)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bag := otelbaggage.FromContext(r.Context())
+
+		fields := make(map[string]string, len(members))
+		attrs := make([]attribute.KeyValue, 0, len(members))
+		for _, member := range members {
+			if value := bag.Member(member).Value(); value != "" {
+				fields[member] = value
+				attrs = append(attrs, attribute.String(member, value))
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+
+		ctx := baggage.WithFields(r.Context(), fields)
+		if !cfg.Baggage.MetricLabels {
+			h.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		code := strconv.Itoa(sw.status)
+		for _, member := range members {
+			value := fields[member]
+			if value != "" {
+				value = labels[member].Label(value)
+			}
+			baggageRequests.WithLabelValues(member, value, code).Inc()
+		}
+	})
+}
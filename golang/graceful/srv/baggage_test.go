@@ -0,0 +1,92 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	otelbaggage "go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/contextcloud/graceful/baggage"
+	"github.com/contextcloud/graceful/config"
+)
+
+func withMembers(t *testing.T, ctx context.Context, members map[string]string) context.Context {
+	t.Helper()
+	bag := otelbaggage.FromContext(ctx)
+	for key, value := range members {
+		member, err := otelbaggage.NewMember(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bag, err = bag.SetMember(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return otelbaggage.ContextWithBaggage(ctx, bag)
+}
+
+func TestWithBaggage(t *testing.T) {
+	cfg := &config.Config{Baggage: config.BaggageConfig{
+		Members:      []string{"tenant.id", "plan"},
+		MetricLabels: true,
+		MaxValues:    1,
+	}}
+
+	var fields map[string]string
+	h := WithBaggage(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields = baggage.Fields(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	tp := sdktrace.NewTracerProvider()
+	serve := func(members map[string]string) []attribute.KeyValue {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		defer span.End()
+		ctx = withMembers(t, ctx, members)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return span.(sdktrace.ReadOnlySpan).Attributes()
+	}
+	count := func(member string, value string) float64 {
+		return testutil.ToFloat64(baggageRequests.WithLabelValues(member, value, "202"))
+	}
+
+	acme, other, noPlan := count("tenant.id", "acme"), count("tenant.id", OtherBaggageValue), count("plan", "")
+
+	// members which aren't configured stay out of spans, logs and metrics.
+	attrs := serve(map[string]string{"tenant.id": "acme", "session": "secret"})
+	if want := []attribute.KeyValue{attribute.String("tenant.id", "acme")}; !reflect.DeepEqual(attrs, want) {
+		t.Errorf("span attributes = %v, want %v", attrs, want)
+	}
+	if want := map[string]string{"tenant.id": "acme"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("log fields = %v, want %v", fields, want)
+	}
+
+	// past MaxValues values share one label.
+	serve(map[string]string{"tenant.id": "globex"})
+
+	if got := count("tenant.id", "acme") - acme; got != 1 {
+		t.Errorf("acme requests = %v, want 1", got)
+	}
+	if got := count("tenant.id", OtherBaggageValue) - other; got != 1 {
+		t.Errorf("requests past the value limit = %v, want 1", got)
+	}
+	if got := count("plan", "") - noPlan; got != 2 {
+		t.Errorf("requests without a plan = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(baggageRequests.WithLabelValues("session", "secret", "202")); got != 0 {
+		t.Errorf("unconfigured member counted %v times", got)
+	}
+}
+
+func TestWithBaggageWithoutMembers(t *testing.T) {
+	h := http.NotFoundHandler()
+	if got := WithBaggage(&config.Config{}, h); reflect.ValueOf(got).Pointer() != reflect.ValueOf(h).Pointer() {
+		t.Error("handler wrapped without members configured")
+	}
+}
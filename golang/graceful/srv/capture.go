@@ -0,0 +1,204 @@
+package srv
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/logging"
+)
+
+// capturedBody keeps the first max bytes written to it.
+type capturedBody struct {
+	max       int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (c *capturedBody) write(b []byte) {
+	if room := c.max - c.buf.Len(); len(b) > room {
+		c.truncated = true
+		if room <= 0 {
+			return
+		}
+		b = b[:room]
+	}
+	c.buf.Write(b)
+}
+
+// captureReader copies the request body as the function reads it, so
+// nothing is read ahead of the function.
+type captureReader struct {
+	io.ReadCloser
+	body *capturedBody
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.write(p[:n])
+	return n, err
+}
+
+// captureWriter copies the response as it is written, flushes and hijacks
+// still go straight through.
+type captureWriter struct {
+	*statusWriter
+	allowed func(contentType string) bool
+	body    *capturedBody
+	checked bool
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if !w.checked {
+		w.checked = true
+		if ct := w.Header().Get("Content-Type"); ct != "" && !w.allowed(ct) {
+			w.body = nil
+		}
+	}
+
+	n, err := w.statusWriter.Write(b)
+	if w.body != nil {
+		w.body.write(b[:n])
+	}
+	return n, err
+}
+
+type capture struct {
+	cfg      config.CaptureConfig
+	redactor *redactor
+	types    map[string]struct{}
+	ratios   map[string]float64
+}
+
+// allowed matches a content type against the allowlist, which can hold
+// whole types like text/*.
+func (c *capture) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.types[mediaType]; ok {
+		return true
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	_, ok := c.types[major+"/*"]
+	return ok
+}
+
+func (c *capture) sampled(route string) bool {
+	ratio, ok := c.ratios[route]
+	if !ok {
+		ratio = c.cfg.Ratio
+	}
+	return ratio >= 1 || rand.Float64() < ratio
+}
+
+func (c *capture) headerAttributes(prefix string, headers map[string][]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(headers))
+	for key, values := range headers {
+		attrs = append(attrs, attribute.StringSlice(prefix+strings.ToLower(key), values))
+	}
+	return attrs
+}
+
+func (c *capture) report(r *http.Request, w *captureWriter, req *capturedBody) {
+	reqHeaders := c.redactor.Headers(r.Header)
+	resHeaders := c.redactor.Headers(w.Header())
+
+	fields := []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", w.status),
+		zap.Any("request_headers", reqHeaders),
+		zap.Any("response_headers", resHeaders),
+	}
+	attrs := append(
+		c.headerAttributes("http.request.header.", reqHeaders),
+		c.headerAttributes("http.response.header.", resHeaders)...,
+	)
+
+	if req != nil {
+		if body, ok := c.redactor.Body(r.Header.Get("Content-Type"), req.buf.Bytes()); ok {
+			fields = append(fields, zap.String("request_body", body))
+			attrs = append(attrs, attribute.String("http.request.body", body))
+		}
+		fields = append(fields, zap.Bool("request_body_truncated", req.truncated))
+	}
+
+	if res := w.body; res != nil {
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(res.buf.Bytes())
+		}
+		if c.allowed(contentType) {
+			if body, ok := c.redactor.Body(contentType, res.buf.Bytes()); ok {
+				fields = append(fields, zap.String("response_body", body))
+				attrs = append(attrs, attribute.String("http.response.body", body))
+			}
+			fields = append(fields, zap.Bool("response_body_truncated", res.truncated))
+		}
+	}
+
+	logging.FromContext(r.Context()).Info("captured request", fields...)
+	if c.cfg.Spans {
+		trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+	}
+}
+
+// WithCapture logs redacted request and response bodies for a sample of the
+// requests, for debugging functions in staging. Bodies are copied as they
+// stream through and nothing is wrapped when capture is disabled.
+func WithCapture(cfg *config.Config, h http.Handler) (http.Handler, error) {
+	if !cfg.Capture.Enabled {
+		return h, nil
+	}
+
+	redactor, err := newRedactor(cfg.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &capture{
+		cfg:      cfg.Capture,
+		redactor: redactor,
+		types:    make(map[string]struct{}, len(cfg.Capture.ContentTypes)),
+		ratios:   make(map[string]float64, len(cfg.Capture.Rules)),
+	}
+	for _, contentType := range cfg.Capture.ContentTypes {
+		c.types[strings.ToLower(contentType)] = struct{}{}
+	}
+	for _, rule := range cfg.Capture.Rules {
+		c.ratios[rule.Route] = rule.Ratio
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.sampled(RouteFromContext(r.Context())) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var req *capturedBody
+		if r.Body != nil && r.Body != http.NoBody && c.allowed(r.Header.Get("Content-Type")) {
+			req = &capturedBody{max: cfg.Capture.MaxSize}
+			// the body is swapped on a copy, the caller's request keeps its own.
+			r = r.WithContext(r.Context())
+			r.Body = &captureReader{ReadCloser: r.Body, body: req}
+		}
+
+		cw := &captureWriter{
+			statusWriter: &statusWriter{ResponseWriter: w, status: http.StatusOK},
+			allowed:      c.allowed,
+			body:         &capturedBody{max: cfg.Capture.MaxSize},
+		}
+		h.ServeHTTP(cw, r)
+		c.report(r, cw, req)
+	}), nil
+}
@@ -0,0 +1,135 @@
+package srv
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func captureConfig(maxSize int) *config.Config {
+	return &config.Config{Capture: config.CaptureConfig{
+		Enabled:      true,
+		MaxSize:      maxSize,
+		ContentTypes: []string{"text/plain"},
+		Ratio:        1,
+	}}
+}
+
+func captured(t *testing.T, logs *observer.ObservedLogs) map[string]interface{} {
+	t.Helper()
+	entries := logs.FilterMessage("captured request").All()
+	if len(entries) != 1 {
+		t.Fatalf("%d captures logged, want 1", len(entries))
+	}
+	return entries[0].ContextMap()
+}
+
+func TestCaptureLimit(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	var read string
+	h, err := WithCapture(captureConfig(8), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		read = string(b)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "a response longer than eight bytes")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a request longer than eight bytes"))
+	r.Header.Set("Content-Type", "text/plain")
+	body := r.Body
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	// the function and the client see everything, only the log is cut.
+	if read != "a request longer than eight bytes" {
+		t.Errorf("function read %q", read)
+	}
+	if got := w.Body.String(); got != "a response longer than eight bytes" {
+		t.Errorf("client got %q", got)
+	}
+	if r.Body != body {
+		t.Error("the caller's request body was replaced")
+	}
+
+	fields := captured(t, logs)
+	want := map[string]interface{}{
+		"request_body":            "a reques",
+		"request_body_truncated":  true,
+		"response_body":           "a respon",
+		"response_body_truncated": true,
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+}
+
+func TestCaptureUnreadBody(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	h, err := WithCapture(captureConfig(64), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("never read"))
+	r.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	// nothing is read ahead of the function.
+	fields := captured(t, logs)
+	if got, ok := fields["request_body"]; ok && got != "" {
+		t.Errorf("request_body = %q, want nothing read", got)
+	}
+	if fields["status"] != int64(http.StatusNoContent) {
+		t.Errorf("status = %v", fields["status"])
+	}
+	rest, _ := io.ReadAll(r.Body)
+	if string(rest) != "never read" {
+		t.Errorf("caller's body left with %q", rest)
+	}
+}
+
+func TestCaptureDisabled(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("streamed"))
+	r.Header.Set("Content-Type", "text/plain")
+
+	cfg := captureConfig(8)
+	cfg.Capture.Enabled = false
+	h, err := WithCapture(cfg, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the request and the writer go straight through.
+		if w != recorder {
+			t.Error("the writer is wrapped")
+		}
+		if req != r {
+			t.Error("the request is copied")
+		}
+		io.Copy(w, req.Body)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(recorder, r)
+
+	if got := recorder.Body.String(); got != "streamed" {
+		t.Errorf("client got %q", got)
+	}
+}
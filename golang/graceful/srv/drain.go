@@ -0,0 +1,95 @@
+package srv
+
+import (
+	"context"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Phase is a named service which is stopped on its own during a drain.
+type Phase struct {
+	Name    string
+	Service Startable
+}
+
+type drain struct {
+	health *Health
+	delay  time.Duration
+	phases []Phase
+}
+
+func (d *drain) Start(ctx context.Context) error {
+	errs, ctx := errgroup.WithContext(ctx)
+
+	for _, p := range d.phases {
+		current := p.Service
+		errs.Go(func() error {
+			return current.Start(ctx)
+		})
+	}
+
+	return errs.Wait()
+}
+
+// Shutdown fails readiness, waits for the pre-stop delay so load balancers
+// stop routing to us and then stops every phase in order.
+func (d *drain) Shutdown(ctx context.Context) error {
+	start := time.Now()
+	zap.L().Info("shutdown: draining")
+
+	var all error
+	d.step(ctx, "readiness", func(ctx context.Context) error {
+		d.health.Drain()
+		return nil
+	})
+	if err := d.step(ctx, "delay", d.wait); err != nil {
+		all = multierror.Append(all, err)
+	}
+	for _, p := range d.phases {
+		if err := d.step(ctx, p.Name, p.Service.Shutdown); err != nil {
+			all = multierror.Append(all, err)
+		}
+	}
+
+	zap.L().Info("shutdown: drained", zap.Duration("duration", time.Since(start)))
+	return all
+}
+
+func (d *drain) step(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	if err := fn(ctx); err != nil {
+		zap.L().Error("shutdown: step failed", zap.String("step", name), zap.Duration("duration", time.Since(start)), zap.Error(err))
+		return err
+	}
+	zap.L().Info("shutdown: step done", zap.String("step", name), zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func (d *drain) wait(ctx context.Context) error {
+	if d.delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewDrain starts every phase together. On shutdown the phases are stopped
+// one after another, so list the main server first and health last.
+func NewDrain(health *Health, delay time.Duration, phases ...Phase) Startable {
+	return &drain{
+		health: health,
+		delay:  delay,
+		phases: phases,
+	}
+}
@@ -0,0 +1,81 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// stopRecorder notes when it is stopped and whether readiness had failed by then.
+type stopRecorder struct {
+	name    string
+	health  *Health
+	stopped *[]string
+}
+
+func (s *stopRecorder) Start(ctx context.Context) error {
+	return nil
+}
+
+func (s *stopRecorder) Shutdown(ctx context.Context) error {
+	if !errors.Is(s.health.checkDraining(), ErrDraining) {
+		*s.stopped = append(*s.stopped, s.name+" while ready")
+		return nil
+	}
+	*s.stopped = append(*s.stopped, s.name)
+	return nil
+}
+
+func drainPhases(health *Health, stopped *[]string, names ...string) []Phase {
+	phases := make([]Phase, 0, len(names))
+	for _, name := range names {
+		phases = append(phases, Phase{Name: name, Service: &stopRecorder{name: name, health: health, stopped: stopped}})
+	}
+	return phases
+}
+
+func TestDrainOrder(t *testing.T) {
+	order := []string{"server", "tracer", "meter", "pushgateway", "metrics", "admin", "health"}
+
+	health := NewHealth(&config.Config{HealthAddr: "127.0.0.1:0"})
+	var stopped []string
+	delay := 50 * time.Millisecond
+	d := NewDrain(health, delay, drainPhases(health, &stopped, order...)...)
+
+	start := time.Now()
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < delay {
+		t.Errorf("stopped after %v, before the %v delay", took, delay)
+	}
+	if !reflect.DeepEqual(stopped, order) {
+		t.Errorf("stopped %v, want %v", stopped, order)
+	}
+}
+
+func TestDrainDelayCancelled(t *testing.T) {
+	health := NewHealth(&config.Config{HealthAddr: "127.0.0.1:0"})
+	var stopped []string
+	d := NewDrain(health, time.Hour, drainPhases(health, &stopped, "server", "health")...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := d.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("waited %v for the delay", took)
+	}
+	// the phases are still stopped once the delay is cut short.
+	if want := []string{"server", "health"}; !reflect.DeepEqual(stopped, want) {
+		t.Errorf("stopped %v, want %v", stopped, want)
+	}
+}
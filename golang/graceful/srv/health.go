@@ -0,0 +1,290 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heptiolabs/healthcheck"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+var ErrDraining = errors.New("draining")
+
+const (
+	livenessCheck  = "liveness"
+	readinessCheck = "readiness"
+
+	statusOk      = "ok"
+	statusFailing = "failing"
+)
+
+var (
+	healthCheckStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_status",
+		Help: "Whether the last run of a health check passed (1) or failed (0).",
+	}, []string{"check", "type"})
+	healthCheckTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "health_check_transitions_total",
+		Help: "Number of times a health check changed status.",
+	}, []string{"check", "type", "status"})
+	healthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "health_check_duration_seconds",
+		Help:    "Time taken to run a health check.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"check", "type"})
+)
+
+func init() {
+	prometheus.MustRegister(healthCheckStatus, healthCheckTransitions, healthCheckDuration)
+}
+
+type check struct {
+	name  string
+	kind  string
+	check healthcheck.Check
+
+	mu                  sync.Mutex
+	status              string
+	lastError           string
+	lastSuccess         time.Time
+	duration            time.Duration
+	consecutiveFailures int
+}
+
+type checkReport struct {
+	Type                string     `json:"type"`
+	Status              string     `json:"status"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	Duration            string     `json:"duration"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime,omitempty"`
+	Info   map[string]interface{} `json:"info,omitempty"`
+	Checks map[string]checkReport `json:"checks,omitempty"`
+}
+
+func (c *check) run() bool {
+	start := time.Now()
+	err := c.check()
+	duration := time.Since(start)
+
+	status := statusOk
+	if err != nil {
+		status = statusFailing
+	}
+
+	c.mu.Lock()
+	previous := c.status
+	c.status = status
+	c.duration = duration
+	if err != nil {
+		c.lastError = err.Error()
+		c.consecutiveFailures++
+	} else {
+		c.lastSuccess = start
+		c.consecutiveFailures = 0
+	}
+	c.mu.Unlock()
+
+	healthCheckDuration.WithLabelValues(c.name, c.kind).Observe(duration.Seconds())
+	if previous != status {
+		// the first run sets the status, it isn't a transition.
+		if previous != "" {
+			healthCheckTransitions.WithLabelValues(c.name, c.kind, status).Inc()
+		}
+		if err != nil {
+			healthCheckStatus.WithLabelValues(c.name, c.kind).Set(0)
+		} else {
+			healthCheckStatus.WithLabelValues(c.name, c.kind).Set(1)
+		}
+	}
+
+	return err == nil
+}
+
+func (c *check) report() checkReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := checkReport{
+		Type:                c.kind,
+		Status:              c.status,
+		LastError:           c.lastError,
+		Duration:            c.duration.String(),
+		ConsecutiveFailures: c.consecutiveFailures,
+	}
+	if !c.lastSuccess.IsZero() {
+		lastSuccess := c.lastSuccess
+		out.LastSuccess = &lastSuccess
+	}
+	return out
+}
+
+type Health struct {
+	mux     *http.ServeMux
+	server  Startable
+	started time.Time
+
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks []*check
+	info   map[string]interface{}
+}
+
+func (h *Health) Start(ctx context.Context) error {
+	return h.server.Start(ctx)
+}
+
+func (h *Health) Shutdown(ctx context.Context) error {
+	return h.server.Shutdown(ctx)
+}
+
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Drain fails the readiness check so the instance is taken out of rotation
+// while the liveness checks keep passing.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// AddLivenessCheck adds a check which restarts the instance when it fails.
+func (h *Health) AddLivenessCheck(name string, c healthcheck.Check) {
+	h.addCheck(name, livenessCheck, c)
+}
+
+// AddReadinessCheck adds a check which takes the instance out of rotation
+// when it fails.
+func (h *Health) AddReadinessCheck(name string, c healthcheck.Check) {
+	h.addCheck(name, readinessCheck, c)
+}
+
+// Handle serves an extra endpoint on the health server.
+func (h *Health) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+// AddInfo adds a section to the verbose health report. A value of type
+// func() interface{} is called every time the report is rendered.
+func (h *Health) AddInfo(name string, value interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.info[name] = value
+}
+
+func (h *Health) addCheck(name string, kind string, c healthcheck.Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, &check{name: name, kind: kind, check: c})
+}
+
+func (h *Health) checkDraining() error {
+	if h.draining.Load() {
+		return ErrDraining
+	}
+	return nil
+}
+
+func (h *Health) selectChecks(kinds ...string) []*check {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var out []*check
+	for _, c := range h.checks {
+		for _, kind := range kinds {
+			if c.kind == kind {
+				out = append(out, c)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (h *Health) infoReport() map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := make(map[string]interface{}, len(h.info))
+	for name, value := range h.info {
+		if fn, ok := value.(func() interface{}); ok {
+			value = fn()
+		}
+		out[name] = value
+	}
+	return out
+}
+
+func (h *Health) handler(detailed bool, kinds ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		checks := h.selectChecks(kinds...)
+		report := healthReport{Status: statusOk}
+		status := http.StatusOK
+		for _, c := range checks {
+			if !c.run() {
+				report.Status = statusFailing
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		// probes only look at the status code, so keep the body small unless
+		// we have been asked for everything.
+		if _, verbose := r.URL.Query()["verbose"]; verbose {
+			report.Checks = make(map[string]checkReport, len(checks))
+			for _, c := range checks {
+				report.Checks[c.name] = c.report()
+			}
+			if detailed {
+				report.Uptime = time.Since(h.started).Round(time.Second).String()
+				report.Info = h.infoReport()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		if err := encoder.Encode(report); err != nil {
+			zap.L().Warn("health: write report", zap.Error(err))
+		}
+	}
+}
+
+func NewHealth(cfg *config.Config) *Health {
+	health := &Health{
+		mux:     http.NewServeMux(),
+		started: time.Now(),
+		info:    make(map[string]interface{}),
+	}
+	if cfg.Health.MaxGoroutines > 0 {
+		health.AddLivenessCheck("goroutine-threshold", healthcheck.GoroutineCountCheck(cfg.Health.MaxGoroutines))
+	}
+	health.AddReadinessCheck("draining", health.checkDraining)
+
+	health.mux.Handle("/live", health.handler(false, livenessCheck))
+	health.mux.Handle("/ready", health.handler(false, readinessCheck, livenessCheck))
+	health.mux.Handle("/health", health.handler(true, readinessCheck, livenessCheck))
+	health.server = NewStandard(cfg.HealthAddr, health)
+
+	return health
+}
@@ -0,0 +1,67 @@
+package srv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestCheckTransitions(t *testing.T) {
+	var failing bool
+	c := &check{name: "transitions", kind: readinessCheck, check: func() error {
+		if failing {
+			return errors.New("down")
+		}
+		return nil
+	}}
+	transitions := func(status string) float64 {
+		return testutil.ToFloat64(healthCheckTransitions.WithLabelValues(c.name, c.kind, status))
+	}
+
+	c.run()
+	c.run()
+	if got := transitions(statusOk); got != 0 {
+		t.Fatalf("first run counted as a transition: %v", got)
+	}
+
+	failing = true
+	c.run()
+	failing = false
+	c.run()
+	if got := transitions(statusFailing); got != 1 {
+		t.Errorf("failing transitions = %v, want 1", got)
+	}
+	if got := transitions(statusOk); got != 1 {
+		t.Errorf("ok transitions = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(healthCheckStatus.WithLabelValues(c.name, c.kind)); got != 1 {
+		t.Errorf("status = %v, want 1", got)
+	}
+}
+
+func TestGoroutineThreshold(t *testing.T) {
+	tests := map[string]struct {
+		max  int
+		want int
+	}{
+		"under the limit": {max: 100000, want: http.StatusOK},
+		"over the limit":  {max: 1, want: http.StatusServiceUnavailable},
+		"turned off":      {max: 0, want: http.StatusOK},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			health := NewHealth(&config.Config{Health: config.HealthConfig{MaxGoroutines: tt.max}})
+			w := httptest.NewRecorder()
+			health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/live", nil))
+			if w.Code != tt.want {
+				t.Errorf("/live = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package srv
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/baggage"
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/logging"
+)
+
+// requestIDHeaders are checked in order, OpenFaaS sets X-Call-Id.
+var requestIDHeaders = []string{"X-Request-Id", "X-Call-Id"}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestID(r *http.Request) string {
+	for _, header := range requestIDHeaders {
+		if id := r.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	return newRequestID()
+}
+
+// WithLogging puts a logger tagged with the trace, request id, route and
+// baggage fields in the request context for logging.FromContext.
+func WithLogging(cfg *config.Config, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set("X-Request-Id", id)
+
+		fields := []zap.Field{
+			zap.String("request_id", id),
+			zap.String("route", RouteFromContext(r.Context())),
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			fields = append(fields,
+				zap.String("trace_id", sc.TraceID().String()),
+				zap.String("span_id", sc.SpanID().String()),
+			)
+		}
+		for key, value := range baggage.Fields(r.Context()) {
+			fields = append(fields, zap.String(key, value))
+		}
+
+		ctx := logging.WithLogger(r.Context(), zap.L().With(fields...))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,74 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/contextcloud/graceful/baggage"
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/logging"
+)
+
+func TestWithLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	h := WithLogging(&config.Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("handled")
+	}))
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	ctx = baggage.WithFields(ctx, map[string]string{"tenant.id": "acme"})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	r.Header.Set("X-Call-Id", "call-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("X-Request-Id"); got != "call-1" {
+		t.Errorf("X-Request-Id = %q, want the call id", got)
+	}
+	entries := logs.FilterMessage("handled").All()
+	if len(entries) != 1 {
+		t.Fatalf("%d entries logged", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]interface{}{
+		"request_id": "call-1",
+		"route":      CatchAllRoute,
+		"trace_id":   span.SpanContext().TraceID().String(),
+		"span_id":    span.SpanContext().SpanID().String(),
+		"tenant.id":  "acme",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+}
+
+func TestWithLoggingNewRequestID(t *testing.T) {
+	h := WithLogging(&config.Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		id := w.Header().Get("X-Request-Id")
+		if len(id) != 16 {
+			t.Errorf("request id %q, want 16 hex characters", id)
+		}
+		ids[id] = true
+	}
+	if len(ids) != 2 {
+		t.Error("request ids repeat")
+	}
+}
@@ -0,0 +1,217 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+const instrumentationName = "github.com/contextcloud/graceful"
+
+// Meter pushes metrics somewhere other than the prometheus endpoint. It also
+// records the request metrics so they are pushed along with everything else.
+type Meter interface {
+	Startable
+	httpmetrics.Recorder
+}
+
+type noopMeter struct {
+	noop
+	httpmetrics.Recorder
+}
+
+func NewNoopMeter() Meter {
+	return &noopMeter{Recorder: httpmetrics.Dummy}
+}
+
+type meter struct {
+	*otelRecorder
+
+	mp *metric.MeterProvider
+}
+
+func (m *meter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (m *meter) Shutdown(ctx context.Context) error {
+	m.mp.ForceFlush(ctx)
+	return m.mp.Shutdown(ctx)
+}
+
+func newMeter(exporter metric.Exporter, interval time.Duration, res *resource.Resource) (Meter, error) {
+	var opts []metric.PeriodicReaderOption
+	if interval > 0 {
+		opts = append(opts, metric.WithInterval(interval))
+	}
+
+	mp := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(exporter, opts...)),
+		metric.WithResource(res),
+	)
+	global.SetMeterProvider(mp)
+
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		return nil, err
+	}
+
+	recorder, err := newOtelRecorder(mp.Meter(instrumentationName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &meter{
+		otelRecorder: recorder,
+		mp:           mp,
+	}, nil
+}
+
+func NewOtlpGrpcMeter(ctx context.Context, cfg config.MetricsConfig, res *resource.Resource) (Meter, error) {
+	opts := []otlpmetricgrpc.Option{}
+	if cfg.Url != "" {
+		opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Url))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newMeter(exporter, cfg.Interval, res)
+}
+
+func NewOtlpHttpMeter(ctx context.Context, cfg config.MetricsConfig, res *resource.Resource) (Meter, error) {
+	opts := []otlpmetrichttp.Option{}
+	if cfg.Url != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Url))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newMeter(exporter, cfg.Interval, res)
+}
+
+// NewMeter pushes metrics to an OpenTelemetry collector or a StatsD agent.
+// The prometheus endpoint served by NewMetricsServer keeps working either
+// way. The gatherer holds the function metrics for meters which can't take
+// them any other way.
+func NewMeter(ctx context.Context, cfg *config.Config, res *resource.Resource, gatherer prometheus.Gatherer) (Meter, error) {
+	switch cfg.Metrics.Type {
+	case "", "prometheus":
+		return NewNoopMeter(), nil
+	case "statsd":
+		return NewStatsd(cfg, false, gatherer)
+	case "dogstatsd":
+		return NewStatsd(cfg, true, gatherer)
+	case "otlp-grpc":
+		return NewOtlpGrpcMeter(ctx, cfg.Metrics, res)
+	case "otlp-http":
+		return NewOtlpHttpMeter(ctx, cfg.Metrics, res)
+	default:
+		return nil, fmt.Errorf("unknown metrics type: %s", cfg.Metrics.Type)
+	}
+}
+
+// otelRecorder records the request metrics of go-http-metrics with an
+// OpenTelemetry meter.
+type otelRecorder struct {
+	duration syncfloat64.Histogram
+	size     syncint64.Histogram
+	inflight syncint64.UpDownCounter
+}
+
+func (o *otelRecorder) ObserveHTTPRequestDuration(ctx context.Context, props httpmetrics.HTTPReqProperties, duration time.Duration) {
+	o.duration.Record(ctx, float64(duration)/float64(time.Millisecond), reqAttributes(props)...)
+}
+
+func (o *otelRecorder) ObserveHTTPResponseSize(ctx context.Context, props httpmetrics.HTTPReqProperties, sizeBytes int64) {
+	o.size.Record(ctx, sizeBytes, reqAttributes(props)...)
+}
+
+func (o *otelRecorder) AddInflightRequests(ctx context.Context, props httpmetrics.HTTPProperties, quantity int) {
+	o.inflight.Add(ctx, int64(quantity), attribute.String("http.route", props.ID))
+}
+
+func reqAttributes(props httpmetrics.HTTPReqProperties) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("http.route", props.ID),
+		semconv.HTTPMethodKey.String(props.Method),
+		attribute.String("http.status_code", props.Code),
+	}
+}
+
+func newOtelRecorder(m otelmetric.Meter) (*otelRecorder, error) {
+	duration, err := m.SyncFloat64().Histogram("http.server.duration",
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("The duration of inbound HTTP requests."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	size, err := m.SyncInt64().Histogram("http.server.response.size",
+		instrument.WithUnit(unit.Bytes),
+		instrument.WithDescription("The size of HTTP response bodies."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	inflight, err := m.SyncInt64().UpDownCounter("http.server.active_requests",
+		instrument.WithDescription("The number of concurrent HTTP requests in flight."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otelRecorder{
+		duration: duration,
+		size:     size,
+		inflight: inflight,
+	}, nil
+}
+
+// multiRecorder fans request metrics out to every recorder.
+type multiRecorder []httpmetrics.Recorder
+
+func (m multiRecorder) ObserveHTTPRequestDuration(ctx context.Context, props httpmetrics.HTTPReqProperties, duration time.Duration) {
+	for _, r := range m {
+		r.ObserveHTTPRequestDuration(ctx, props, duration)
+	}
+}
+
+func (m multiRecorder) ObserveHTTPResponseSize(ctx context.Context, props httpmetrics.HTTPReqProperties, sizeBytes int64) {
+	for _, r := range m {
+		r.ObserveHTTPResponseSize(ctx, props, sizeBytes)
+	}
+}
+
+func (m multiRecorder) AddInflightRequests(ctx context.Context, props httpmetrics.HTTPProperties, quantity int) {
+	for _, r := range m {
+		r.AddInflightRequests(ctx, props, quantity)
+	}
+}
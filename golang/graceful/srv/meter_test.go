@@ -0,0 +1,159 @@
+package srv
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+	"go.opentelemetry.io/otel/sdk/resource"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+type otlpRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newOtlpHTTPReceiver is an OTLP/HTTP collector which hands over every
+// request it gets, already decompressed.
+func newOtlpHTTPReceiver(t *testing.T) (*httptest.Server, <-chan otlpRequest) {
+	t.Helper()
+	requests := make(chan otlpRequest, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("gzip: %v", err)
+				return
+			}
+			body = gz
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		requests <- otlpRequest{path: r.URL.Path, header: r.Header.Clone(), body: b}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func receive(t *testing.T, requests <-chan otlpRequest) otlpRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing exported")
+		return otlpRequest{}
+	}
+}
+
+func metricNames(req *colmetricpb.ExportMetricsServiceRequest) map[string]bool {
+	names := make(map[string]bool)
+	for _, rm := range req.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				names[m.GetName()] = true
+			}
+		}
+	}
+	return names
+}
+
+func recordRequest(m Meter) {
+	props := httpmetrics.HTTPReqProperties{ID: "/users/{id}", Method: http.MethodGet, Code: "200"}
+	m.ObserveHTTPRequestDuration(context.Background(), props, 20*time.Millisecond)
+	m.ObserveHTTPResponseSize(context.Background(), props, 512)
+}
+
+func TestOtlpHttpMeter(t *testing.T) {
+	server, requests := newOtlpHTTPReceiver(t)
+	ctx := context.Background()
+
+	m, err := NewOtlpHttpMeter(ctx, config.MetricsConfig{
+		Url:      server.Listener.Addr().String(),
+		Insecure: true,
+		Interval: time.Hour,
+	}, resource.Empty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordRequest(m)
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	req := receive(t, requests)
+	if req.path != "/v1/metrics" {
+		t.Errorf("path = %s", req.path)
+	}
+	var export colmetricpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(req.body, &export); err != nil {
+		t.Fatal(err)
+	}
+	names := metricNames(&export)
+	for _, name := range []string{"http.server.duration", "http.server.response.size"} {
+		if !names[name] {
+			t.Errorf("%s not exported, got %v", name, names)
+		}
+	}
+}
+
+type metricsService struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	requests chan *colmetricpb.ExportMetricsServiceRequest
+}
+
+func (s *metricsService) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	s.requests <- req
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOtlpGrpcMeter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &metricsService{requests: make(chan *colmetricpb.ExportMetricsServiceRequest, 16)}
+	server := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(server, service)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	ctx := context.Background()
+	m, err := NewOtlpGrpcMeter(ctx, config.MetricsConfig{
+		Url:      lis.Addr().String(),
+		Insecure: true,
+		Interval: time.Hour,
+	}, resource.Empty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordRequest(m)
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case export := <-service.requests:
+		if names := metricNames(export); !names["http.server.duration"] {
+			t.Errorf("http.server.duration not exported, got %v", names)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing exported")
+	}
+}
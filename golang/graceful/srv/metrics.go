@@ -0,0 +1,19 @@
+package srv
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewMetricsServer serves the gatherer, see metrics.NewGatherer for one
+// which includes the default registry and the function registry. Scrapers
+// asking for OpenMetrics also get the trace exemplars.
+func NewMetricsServer(metricsAddr string, gatherer prometheus.Gatherer) Startable {
+	handler := promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}),
+	)
+	return NewStandard(metricsAddr, handler)
+}
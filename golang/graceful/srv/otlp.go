@@ -0,0 +1,138 @@
+package srv
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func otlpHeaders(headers []string) (map[string]string, error) {
+	out := make(map[string]string, len(headers))
+	for _, header := range headers {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid otlp header, want key=value: %q", header)
+		}
+		out[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+// otlpTLS returns nil when no certificates are configured so the exporter
+// uses the system roots.
+func otlpTLS(cfg config.OtlpConfig) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil
+	}
+
+	out := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read otlp ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in otlp ca: %s", cfg.CAFile)
+		}
+		out.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load otlp client certificate: %w", err)
+		}
+		out.Certificates = []tls.Certificate{cert}
+	}
+	return out, nil
+}
+
+func NewOtlpGrpcTracer(ctx context.Context, cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	headers, err := otlpHeaders(cfg.Otlp.Headers)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := otlpTLS(cfg.Otlp)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithHeaders(headers),
+	}
+	if cfg.Url != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Url))
+	}
+	if cfg.Otlp.Timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(cfg.Otlp.Timeout))
+	}
+	switch {
+	case cfg.Otlp.Insecure:
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	case tlsCfg != nil:
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+	}
+	switch cfg.Otlp.Compression {
+	case "", "none":
+	case "gzip":
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	default:
+		return nil, fmt.Errorf("unknown otlp compression: %s", cfg.Otlp.Compression)
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, cfg, res)
+}
+
+func NewOtlpHttpTracer(ctx context.Context, cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	headers, err := otlpHeaders(cfg.Otlp.Headers)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := otlpTLS(cfg.Otlp)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithHeaders(headers),
+	}
+	if cfg.Url != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Url))
+	}
+	if cfg.Otlp.Timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(cfg.Otlp.Timeout))
+	}
+	switch {
+	case cfg.Otlp.Insecure:
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case tlsCfg != nil:
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+	}
+	switch cfg.Otlp.Compression {
+	case "", "none":
+	case "gzip":
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	default:
+		return nil, fmt.Errorf("unknown otlp compression: %s", cfg.Otlp.Compression)
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, cfg, res)
+}
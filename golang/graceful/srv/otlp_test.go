@@ -0,0 +1,186 @@
+package srv
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func spanNames(req *coltracepb.ExportTraceServiceRequest) map[string]bool {
+	names := make(map[string]bool)
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				names[s.GetName()] = true
+			}
+		}
+	}
+	return names
+}
+
+// exportSpan sends one span through the tracer, which flushes on Shutdown.
+func exportSpan(t *testing.T, tracer Startable) {
+	t.Helper()
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	_, span := otel.Tracer("test").Start(context.Background(), "checkout")
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tracingConfig(url string, compression string) config.TracingConfig {
+	return config.TracingConfig{
+		Url:      url,
+		Sampling: config.SamplingConfig{Ratio: 1},
+		Otlp: config.OtlpConfig{
+			Insecure:    true,
+			Headers:     []string{"x-api-key = secret"},
+			Compression: compression,
+			Timeout:     5 * time.Second,
+		},
+	}
+}
+
+func TestOtlpHttpTracer(t *testing.T) {
+	for _, compression := range []string{"", "gzip"} {
+		t.Run("compression "+compression, func(t *testing.T) {
+			server, requests := newOtlpHTTPReceiver(t)
+
+			tracer, err := NewOtlpHttpTracer(context.Background(), tracingConfig(server.Listener.Addr().String(), compression), resource.Empty())
+			if err != nil {
+				t.Fatal(err)
+			}
+			exportSpan(t, tracer)
+
+			req := receive(t, requests)
+			if req.path != "/v1/traces" {
+				t.Errorf("path = %s", req.path)
+			}
+			if got := req.header.Get("x-api-key"); got != "secret" {
+				t.Errorf("x-api-key = %q", got)
+			}
+			if got := req.header.Get("Content-Encoding"); got != compression {
+				t.Errorf("Content-Encoding = %q, want %q", got, compression)
+			}
+			var export coltracepb.ExportTraceServiceRequest
+			if err := proto.Unmarshal(req.body, &export); err != nil {
+				t.Fatal(err)
+			}
+			if names := spanNames(&export); !names["checkout"] {
+				t.Errorf("checkout not exported, got %v", names)
+			}
+		})
+	}
+}
+
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	requests chan *coltracepb.ExportTraceServiceRequest
+	headers  chan metadata.MD
+}
+
+func (s *traceService) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.headers <- md
+	s.requests <- req
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// compressionStats notes the compression of the requests a server gets.
+type compressionStats struct {
+	mu          sync.Mutex
+	compression []string
+}
+
+func (c *compressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *compressionStats) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InHeader); ok {
+		c.mu.Lock()
+		c.compression = append(c.compression, in.Compression)
+		c.mu.Unlock()
+	}
+}
+
+func (c *compressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *compressionStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestOtlpGrpcTracer(t *testing.T) {
+	for _, compression := range []string{"", "gzip"} {
+		t.Run("compression "+compression, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			service := &traceService{
+				requests: make(chan *coltracepb.ExportTraceServiceRequest, 16),
+				headers:  make(chan metadata.MD, 16),
+			}
+			compressions := &compressionStats{}
+			server := grpc.NewServer(grpc.StatsHandler(compressions))
+			coltracepb.RegisterTraceServiceServer(server, service)
+			go server.Serve(lis)
+			defer server.Stop()
+
+			tracer, err := NewOtlpGrpcTracer(context.Background(), tracingConfig(lis.Addr().String(), compression), resource.Empty())
+			if err != nil {
+				t.Fatal(err)
+			}
+			exportSpan(t, tracer)
+
+			select {
+			case export := <-service.requests:
+				if names := spanNames(export); !names["checkout"] {
+					t.Errorf("checkout not exported, got %v", names)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("nothing exported")
+			}
+			if got := (<-service.headers).Get("x-api-key"); len(got) != 1 || got[0] != "secret" {
+				t.Errorf("x-api-key = %v", got)
+			}
+
+			compressions.mu.Lock()
+			defer compressions.mu.Unlock()
+			if len(compressions.compression) == 0 {
+				t.Error("no requests seen")
+			}
+			for _, got := range compressions.compression {
+				if got != compression {
+					t.Errorf("compression = %q, want %q", got, compression)
+				}
+			}
+		})
+	}
+}
+
+func TestOtlpCompression(t *testing.T) {
+	cfg := tracingConfig("127.0.0.1:4317", "brotli")
+	if _, err := NewOtlpGrpcTracer(context.Background(), cfg, resource.Empty()); err == nil {
+		t.Error("grpc: unknown compression accepted")
+	}
+	if _, err := NewOtlpHttpTracer(context.Background(), cfg, resource.Empty()); err == nil {
+		t.Error("http: unknown compression accepted")
+	}
+}
@@ -0,0 +1,34 @@
+package srv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NewPropagator builds a propagator from the names in the config, the order
+// given is the order they are extracted in so later ones win.
+func NewPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New())
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "gcp":
+			propagators = append(propagators, propagator.CloudTraceFormatPropagator{})
+		default:
+			return nil, fmt.Errorf("unknown propagator: %s", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
@@ -0,0 +1,160 @@
+package srv
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/platform"
+)
+
+// groupingGatherer drops the labels which are part of the grouping key, the
+// pushgateway refuses metrics carrying them and adds them back itself. The
+// gathered families are copied rather than changed in place.
+type groupingGatherer struct {
+	gatherer prometheus.Gatherer
+	grouping map[string]string
+}
+
+func (g *groupingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	out := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		metrics := make([]*dto.Metric, 0, len(family.GetMetric()))
+		for _, m := range family.GetMetric() {
+			pairs := make([]*dto.LabelPair, 0, len(m.GetLabel()))
+			for _, pair := range m.GetLabel() {
+				if _, ok := g.grouping[pair.GetName()]; !ok {
+					pairs = append(pairs, pair)
+				}
+			}
+			metrics = append(metrics, &dto.Metric{
+				Label:       pairs,
+				Gauge:       m.Gauge,
+				Counter:     m.Counter,
+				Summary:     m.Summary,
+				Untyped:     m.Untyped,
+				Histogram:   m.Histogram,
+				TimestampMs: m.TimestampMs,
+			})
+		}
+		out = append(out, &dto.MetricFamily{
+			Name:   family.Name,
+			Help:   family.Help,
+			Type:   family.Type,
+			Metric: metrics,
+		})
+	}
+	return out, err
+}
+
+type pushgateway struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	timeout  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func (p *pushgateway) Start(ctx context.Context) error {
+	defer close(p.done)
+
+	if p.interval <= 0 {
+		<-p.stop
+		return nil
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.push(ctx)
+		case <-p.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Shutdown makes a final push so batch functions which exit before being
+// scraped still report. Failures are only logged, the push gives up when
+// the shutdown grace period runs out.
+func (p *pushgateway) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return nil
+	}
+
+	p.push(ctx)
+	return nil
+}
+
+func (p *pushgateway) push(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if err := p.pusher.PushContext(ctx); err != nil {
+		zap.L().Warn("pushgateway: push failed", zap.Error(err))
+	}
+}
+
+// NewPushgateway pushes the gatherer to a Prometheus Pushgateway every
+// interval and once more on shutdown, grouped by service, environment and
+// instance. In kubernetes the instance is the pod and the namespace is added.
+func NewPushgateway(cfg *config.Config, gatherer prometheus.Gatherer) Startable {
+	if cfg.Metrics.Pushgateway.Url == "" {
+		return NewNoop()
+	}
+
+	meta := platform.Detect()
+	instance := meta.PodName
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		instance = hostname
+	}
+
+	grouping := map[string]string{
+		"environment": cfg.Environment,
+		"instance":    instance,
+	}
+	if meta.PodNamespace != "" {
+		grouping["namespace"] = meta.PodNamespace
+	}
+
+	pusher := push.New(cfg.Metrics.Pushgateway.Url, cfg.ServiceName)
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	pusher = pusher.Gatherer(&groupingGatherer{gatherer: gatherer, grouping: grouping})
+
+	timeout := cfg.Metrics.Pushgateway.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &pushgateway{
+		pusher:   pusher,
+		interval: cfg.Metrics.Pushgateway.Interval,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
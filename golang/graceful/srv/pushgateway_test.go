@@ -0,0 +1,164 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+type pushed struct {
+	method   string
+	grouping map[string]string
+	families map[string]*dto.MetricFamily
+}
+
+// newPushgatewayServer records what is pushed to it.
+func newPushgatewayServer(t *testing.T) (*httptest.Server, func() []pushed) {
+	t.Helper()
+	var mu sync.Mutex
+	var all []pushed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := pushed{method: r.Method, grouping: map[string]string{}, families: map[string]*dto.MetricFamily{}}
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/"), "/")
+		for i := 0; i+1 < len(segments); i += 2 {
+			p.grouping[segments[i]] = segments[i+1]
+		}
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var family dto.MetricFamily
+			if err := decoder.Decode(&family); err != nil {
+				break
+			}
+			p.families[family.GetName()] = &family
+		}
+
+		mu.Lock()
+		all = append(all, p)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []pushed {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]pushed{}, all...)
+	}
+}
+
+func TestPushgateway(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("K8S_POD_NAME", "")
+	t.Setenv("POD_NAME", "")
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, pushes := newPushgatewayServer(t)
+
+	reg := prometheus.NewRegistry()
+	jobs := prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "jobs_total",
+		ConstLabels: prometheus.Labels{"environment": "test", "service": "orders"},
+	})
+	reg.MustRegister(jobs)
+	jobs.Add(3)
+
+	// the same families are handed out on every gather.
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})
+	labels := len(families[0].GetMetric()[0].GetLabel())
+
+	cfg := &config.Config{
+		ServiceName: "orders",
+		Environment: "test",
+		Metrics:     config.MetricsConfig{Pushgateway: config.PushgatewayConfig{Url: server.URL}},
+	}
+	p := NewPushgateway(cfg, gathered)
+	started := make(chan error, 1)
+	go func() { started <- p.Start(context.Background()) }()
+
+	// without an interval there is only the push on shutdown.
+	time.Sleep(50 * time.Millisecond)
+	if got := len(pushes()); got != 0 {
+		t.Fatalf("%d pushes before shutdown", got)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+
+	all := pushes()
+	if len(all) != 1 {
+		t.Fatalf("%d pushes, want the one on shutdown", len(all))
+	}
+	push := all[0]
+	// a PUT replaces the group, dropping series which are gone, and the
+	// group isn't deleted so it is still scraped after the function exits.
+	if push.method != http.MethodPut {
+		t.Errorf("pushed with %s, want PUT", push.method)
+	}
+	want := map[string]string{"job": "orders", "environment": "test", "instance": hostname}
+	for name, value := range want {
+		if push.grouping[name] != value {
+			t.Errorf("grouping %s = %q, want %q (%v)", name, push.grouping[name], value, push.grouping)
+		}
+	}
+
+	family, ok := push.families["jobs_total"]
+	if !ok {
+		t.Fatalf("jobs_total not pushed: %v", push.families)
+	}
+	for _, pair := range family.GetMetric()[0].GetLabel() {
+		if pair.GetName() == "environment" {
+			t.Error("grouping label pushed with the metric")
+		}
+	}
+	if got := len(families[0].GetMetric()[0].GetLabel()); got != labels {
+		t.Error("the gathered families were changed")
+	}
+}
+
+func TestPushgatewayShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := &config.Config{
+		ServiceName: "orders",
+		Metrics:     config.MetricsConfig{Pushgateway: config.PushgatewayConfig{Url: server.URL}},
+	}
+	p := NewPushgateway(cfg, prometheus.NewRegistry())
+	go p.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("a failed push failed the shutdown: %v", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("shutdown took %v past the grace period", took)
+	}
+}
@@ -0,0 +1,73 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/metrics"
+)
+
+// promRecorder records the same series as the go-http-metrics prometheus
+// recorder, but attaches the active trace to the latency histogram as an
+// exemplar so a spike on a dashboard leads straight to a trace. Requests
+// without a sampled trace are recorded without one.
+type promRecorder struct {
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inflight *prometheus.GaugeVec
+}
+
+func (r *promRecorder) ObserveHTTPRequestDuration(ctx context.Context, props httpmetrics.HTTPReqProperties, duration time.Duration) {
+	observer := r.duration.WithLabelValues(props.Service, props.ID, props.Method, props.Code)
+	metrics.Observe(ctx, observer, duration.Seconds())
+}
+
+func (r *promRecorder) ObserveHTTPResponseSize(ctx context.Context, props httpmetrics.HTTPReqProperties, sizeBytes int64) {
+	r.size.WithLabelValues(props.Service, props.ID, props.Method, props.Code).Observe(float64(sizeBytes))
+}
+
+func (r *promRecorder) AddInflightRequests(ctx context.Context, props httpmetrics.HTTPProperties, quantity int) {
+	r.inflight.WithLabelValues(props.Service, props.ID).Add(float64(quantity))
+}
+
+func newPromRecorder(reg prometheus.Registerer) httpmetrics.Recorder {
+	r := &promRecorder{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "The latency of the HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "handler", "method", "code"}),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "http",
+			Name:      "response_size_bytes",
+			Help:      "The size of the HTTP responses.",
+			Buckets:   prometheus.ExponentialBuckets(100, 10, 8),
+		}, []string{"service", "handler", "method", "code"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "http",
+			Name:      "requests_inflight",
+			Help:      "The number of inflight requests being handled at the same time.",
+		}, []string{"service", "handler"}),
+	}
+
+	// handlers built on the same registry share the series.
+	r.duration = registerCollector(reg, r.duration).(*prometheus.HistogramVec)
+	r.size = registerCollector(reg, r.size).(*prometheus.HistogramVec)
+	r.inflight = registerCollector(reg, r.inflight).(*prometheus.GaugeVec)
+	return r
+}
+
+func registerCollector(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(fmt.Errorf("register metric: %w", err))
+	}
+	return c
+}
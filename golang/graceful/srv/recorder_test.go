@@ -0,0 +1,73 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func durationMetric(t *testing.T, reg *prometheus.Registry) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "http_request_duration_seconds" {
+			return family.GetMetric()[0]
+		}
+	}
+	t.Fatal("http_request_duration_seconds not recorded")
+	return nil
+}
+
+func TestMetricsRecorderExemplars(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	// handlers sharing a registry share the series rather than panic.
+	first := WithMetricsRecorder(reg, h)
+	second := WithMetricsRecorder(reg, h)
+
+	first.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	m := durationMetric(t, reg)
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Fatalf("%d requests recorded, want 1", got)
+	}
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		if bucket.GetExemplar() != nil {
+			t.Fatal("exemplar without a trace")
+		}
+	}
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	second.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx))
+
+	m = durationMetric(t, reg)
+	if got := m.GetHistogram().GetSampleCount(); got != 2 {
+		t.Fatalf("%d requests recorded, want 2", got)
+	}
+	found := false
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		for _, pair := range bucket.GetExemplar().GetLabel() {
+			if pair.GetName() == "trace_id" && pair.GetValue() == span.SpanContext().TraceID().String() {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("no exemplar with the trace")
+	}
+	for _, pair := range m.GetLabel() {
+		if pair.GetName() == "code" && pair.GetValue() != "201" {
+			t.Errorf("code = %s, want 201", pair.GetValue())
+		}
+	}
+}
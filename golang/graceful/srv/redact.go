@@ -0,0 +1,212 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// Redacted replaces header and field values which must not be logged.
+const Redacted = "[REDACTED]"
+
+type pathSegment struct {
+	key  string
+	any  bool
+	deep bool
+}
+
+func (s pathSegment) matches(key string) bool {
+	return s.any || s.key == key
+}
+
+// jsonPath is the subset of JSONPath used for redaction: $.a.b, $['a'],
+// $.items[0], $.items[*].b and $..b for a field at any depth.
+type jsonPath []pathSegment
+
+func parseJSONPath(path string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var out jsonPath
+	for rest != "" {
+		var seg pathSegment
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			seg.deep = true
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %q", path)
+			}
+			seg.key = strings.Trim(rest[1:end], `'"`)
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			seg.key = rest[:end]
+			rest = rest[end:]
+		}
+
+		if seg.key == "" {
+			return nil, fmt.Errorf("empty segment in %q", path)
+		}
+		seg.any = seg.key == "*"
+		out = append(out, seg)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty path %q", path)
+	}
+	return out, nil
+}
+
+func (p jsonPath) redact(v interface{}) {
+	seg, rest := p[0], p[1:]
+
+	visit := func(key string, child interface{}, set func(interface{})) {
+		if seg.matches(key) {
+			if len(rest) == 0 {
+				set(Redacted)
+				return
+			}
+			rest.redact(child)
+		}
+		if seg.deep {
+			p.redact(child)
+		}
+	}
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			key := key
+			visit(key, child, func(value interface{}) { node[key] = value })
+		}
+	case []interface{}:
+		for i, child := range node {
+			i := i
+			visit(strconv.Itoa(i), child, func(value interface{}) { node[i] = value })
+		}
+	}
+}
+
+// field is the name a path redacts in a flat form body, if any.
+func (p jsonPath) field() (pathSegment, bool) {
+	if len(p) != 1 {
+		return pathSegment{}, false
+	}
+	return p[0], true
+}
+
+type redactor struct {
+	headers map[string]struct{}
+	paths   []jsonPath
+}
+
+func newRedactor(cfg config.CaptureConfig) (*redactor, error) {
+	r := &redactor{
+		headers: make(map[string]struct{}, len(cfg.RedactHeaders)),
+	}
+	for _, header := range cfg.RedactHeaders {
+		r.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	for _, path := range cfg.RedactPaths {
+		parsed, err := parseJSONPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("redact path: %w", err)
+		}
+		r.paths = append(r.paths, parsed)
+	}
+	return r, nil
+}
+
+// Headers flattens headers for logging with the redacted ones replaced.
+func (r *redactor) Headers(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for key, values := range h {
+		if _, ok := r.headers[http.CanonicalHeaderKey(key)]; ok {
+			out[key] = []string{Redacted}
+			continue
+		}
+		out[key] = values
+	}
+	return out
+}
+
+func (r *redactor) json(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("trailing data after json value")
+	}
+
+	for _, path := range r.paths {
+		path.redact(v)
+	}
+	return json.Marshal(v)
+}
+
+func (r *redactor) form(body []byte) ([]byte, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for key := range values {
+		for _, path := range r.paths {
+			if seg, ok := path.field(); ok && seg.matches(key) {
+				values[key] = []string{Redacted}
+			}
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+// Body returns a captured body fit for logging. With redact paths set only
+// JSON and forms are logged, and only when they can be redacted, so a body
+// cut off at the size cap or of another type is left out.
+func (r *redactor) Body(contentType string, body []byte) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+
+	if len(r.paths) == 0 {
+		return string(body), true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var err error
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		body, err = r.json(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		body, err = r.form(body)
+	default:
+		return "", false
+	}
+	if err != nil {
+		return "", false
+	}
+	return string(body), true
+}
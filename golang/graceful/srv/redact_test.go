@@ -0,0 +1,75 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := map[string]struct {
+		paths       []string
+		contentType string
+		body        string
+		want        string
+		ok          bool
+	}{
+		"no paths": {
+			contentType: "text/plain",
+			body:        "password=hunter2",
+			want:        "password=hunter2",
+			ok:          true,
+		},
+		"json": {
+			paths:       []string{"$.password", "$..token"},
+			contentType: "application/json; charset=utf-8",
+			body:        `{"user":"ann","password":"hunter2","auth":{"token":"abc"}}`,
+			want:        `{"auth":{"token":"[REDACTED]"},"password":"[REDACTED]","user":"ann"}`,
+			ok:          true,
+		},
+		"json suffix": {
+			paths:       []string{"$.items[*].card"},
+			contentType: "application/vnd.api+json",
+			body:        `{"items":[{"card":"4111"},{"card":"5500"}]}`,
+			want:        `{"items":[{"card":"[REDACTED]"},{"card":"[REDACTED]"}]}`,
+			ok:          true,
+		},
+		"form": {
+			paths:       []string{"$.password"},
+			contentType: "application/x-www-form-urlencoded",
+			body:        "password=hunter2&user=ann",
+			want:        "password=%5BREDACTED%5D&user=ann",
+			ok:          true,
+		},
+		"cut off json": {
+			paths:       []string{"$.password"},
+			contentType: "application/json",
+			body:        `{"password":"hun`,
+		},
+		"text": {
+			paths:       []string{"$.password"},
+			contentType: "text/plain",
+			body:        `{"password":"hunter2"}`,
+		},
+		"no content type": {
+			paths: []string{"$.password"},
+			body:  `{"password":"hunter2"}`,
+		},
+		"empty": {
+			contentType: "application/json",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := newRedactor(config.CaptureConfig{RedactPaths: tt.paths})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := r.Body(tt.contentType, []byte(tt.body))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Body() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
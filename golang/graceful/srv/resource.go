@@ -0,0 +1,184 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/detectors/gcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/platform"
+)
+
+type detectorFunc func(ctx context.Context) (*resource.Resource, error)
+
+func (f detectorFunc) Detect(ctx context.Context) (*resource.Resource, error) {
+	return f(ctx)
+}
+
+func fromOptions(opts ...resource.Option) resource.Detector {
+	return detectorFunc(func(ctx context.Context) (*resource.Resource, error) {
+		return resource.New(ctx, opts...)
+	})
+}
+
+// platformDetector describes the pod or function from the environment.
+func platformDetector(attrs func(platform.Metadata) []attribute.KeyValue) resource.Detector {
+	return detectorFunc(func(ctx context.Context) (*resource.Resource, error) {
+		return resource.NewWithAttributes(semconv.SchemaURL, attrs(platform.Detect())...), nil
+	})
+}
+
+// timeoutDetector gives up on a detector after the timeout as some probe
+// metadata servers which aren't there off their platform. A failed detector
+// is logged and skipped rather than failing startup.
+type timeoutDetector struct {
+	name     string
+	timeout  time.Duration
+	detector resource.Detector
+}
+
+func (d *timeoutDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	if d.timeout <= 0 {
+		return d.detector.Detect(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	type result struct {
+		res *resource.Resource
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := d.detector.Detect(ctx)
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			zap.L().Warn("resource: detector failed", zap.String("detector", d.name), zap.Error(r.err))
+			return resource.Empty(), nil
+		}
+		return r.res, nil
+	case <-ctx.Done():
+		zap.L().Warn("resource: detector timed out", zap.String("detector", d.name), zap.Duration("timeout", d.timeout))
+		return resource.Empty(), nil
+	}
+}
+
+func newDetector(name string) (resource.Detector, error) {
+	switch name {
+	case "gcp":
+		return gcp.NewDetector(), nil
+	case "env":
+		return fromOptions(resource.WithFromEnv()), nil
+	case "host":
+		return fromOptions(resource.WithHost()), nil
+	case "container":
+		return fromOptions(resource.WithContainer()), nil
+	case "k8s":
+		return platformDetector(platform.Metadata.K8sAttributes), nil
+	case "faas":
+		return platformDetector(platform.Metadata.FaaSAttributes), nil
+	default:
+		return nil, fmt.Errorf("unknown resource detector: %s", name)
+	}
+}
+
+// gcpEnv are set by Google Cloud on Cloud Run, Cloud Functions and App
+// Engine, or by hand to pick the project.
+var gcpEnv = []string{"GOOGLE_CLOUD_PROJECT", "K_SERVICE", "FUNCTION_TARGET", "GAE_SERVICE"}
+
+// metadataProbeTimeout bounds the metadata probe when detectors have no
+// timeout, off Google Cloud the address may not answer at all.
+const metadataProbeTimeout = time.Second
+
+// onGCP tells from the environment whether the service runs on Google
+// Cloud, or else asks the metadata server GKE and GCE have. The probe gives
+// up after the timeout.
+func onGCP(ctx context.Context, getenv func(string) string, timeout time.Duration) bool {
+	for _, name := range gcpEnv {
+		if getenv(name) != "" {
+			return true
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = metadataProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	host := getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "169.254.169.254"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/computeMetadata/v1/", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Metadata-Flavor") == "Google"
+}
+
+// detectorNames are the configured detectors, plus gcp when onGCP says so.
+// onGCP is only asked when gcp isn't configured.
+func detectorNames(cfg config.ResourceConfig, onGCP func() bool) []string {
+	names := make([]string, 0, len(cfg.Detectors)+1)
+	gcp := false
+	for _, name := range cfg.Detectors {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		gcp = gcp || name == "gcp"
+		names = append(names, name)
+	}
+	if !gcp && onGCP() {
+		names = append(names, "gcp")
+	}
+	return names
+}
+
+// NewResource describes this service to the trace and metric exporters,
+// it is built once and shared by both.
+func NewResource(ctx context.Context, cfg *config.Config) (*resource.Resource, error) {
+	detectors := []resource.Detector{}
+	probe := func() bool {
+		return onGCP(ctx, os.Getenv, cfg.Resource.Timeout)
+	}
+	for _, name := range detectorNames(cfg.Resource, probe) {
+		detector, err := newDetector(name)
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, &timeoutDetector{name: name, timeout: cfg.Resource.Timeout, detector: detector})
+	}
+
+	return resource.New(ctx,
+		resource.WithDetectors(detectors...),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(cfg.ServiceName),
+			semconv.ServiceVersionKey.String(cfg.Version),
+			semconv.DeploymentEnvironmentKey.String(cfg.Environment),
+		),
+	)
+}
@@ -0,0 +1,127 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestDetectorNames(t *testing.T) {
+	defaults := []string{"env", "host", "k8s", "faas"}
+	tests := map[string]struct {
+		detectors []string
+		onGCP     bool
+		want      []string
+	}{
+		"off gcp": {
+			detectors: defaults,
+			want:      defaults,
+		},
+		"on gcp": {
+			detectors: defaults,
+			onGCP:     true,
+			want:      append(append([]string{}, defaults...), "gcp"),
+		},
+		"configured": {
+			detectors: []string{" GCP ", "", "env"},
+			want:      []string{"gcp", "env"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			asked := false
+			onGCP := func() bool {
+				asked = true
+				return tt.onGCP
+			}
+			got := detectorNames(config.ResourceConfig{Detectors: tt.detectors}, onGCP)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectors = %v, want %v", got, tt.want)
+			}
+			if configured := got[0] == "gcp"; configured && asked {
+				t.Error("probed for gcp when it is configured")
+			}
+		})
+	}
+}
+
+func TestOnGCP(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+	}))
+	defer metadata.Close()
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	host := func(s *httptest.Server) string {
+		return strings.TrimPrefix(s.URL, "http://")
+	}
+	tests := map[string]struct {
+		env  map[string]string
+		want bool
+	}{
+		"cloud run":       {env: map[string]string{"K_SERVICE": "orders", "GCE_METADATA_HOST": host(hanging)}, want: true},
+		"gke":             {env: map[string]string{"GCE_METADATA_HOST": host(metadata)}, want: true},
+		"elsewhere":       {env: map[string]string{"GCE_METADATA_HOST": host(other)}},
+		"nothing answers": {env: map[string]string{"GCE_METADATA_HOST": host(hanging)}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			start := time.Now()
+			if got := onGCP(context.Background(), getenv, 100*time.Millisecond); got != tt.want {
+				t.Errorf("onGCP = %v, want %v", got, tt.want)
+			}
+			if took := time.Since(start); took > 5*time.Second {
+				t.Errorf("probe took %v", took)
+			}
+		})
+	}
+}
+
+func TestProjectId(t *testing.T) {
+	gcp := resource.NewSchemaless(semconv.CloudProviderGCP, semconv.CloudAccountIDKey.String("from-metadata"))
+	aws := resource.NewSchemaless(semconv.CloudProviderAWS, semconv.CloudAccountIDKey.String("123456"))
+
+	tests := map[string]struct {
+		configured string
+		env        string
+		res        *resource.Resource
+		want       string
+	}{
+		"configured":  {configured: "acme", env: "from-env", res: gcp, want: "acme"},
+		"environment": {env: "from-env", res: gcp, want: "from-env"},
+		"detected":    {res: gcp, want: "from-metadata"},
+		"other cloud": {res: aws},
+		"nowhere":     {res: resource.Empty()},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GOOGLE_CLOUD_PROJECT", tt.env)
+			cfg := &config.Config{Tracing: config.TracingConfig{ProjectId: tt.configured}}
+			if got := ProjectId(cfg, tt.res); got != tt.want {
+				t.Errorf("project = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/contextcloud/graceful/metrics"
+)
+
+// OtherRoute is the label used for requests which don't match a known route
+// or which arrive after the route limit has been reached.
+const OtherRoute = "other"
+
+// CatchAllRoute is the label of every request to a handler which doesn't
+// tell its routes, so ids in the path never become labels.
+const CatchAllRoute = "/*"
+
+// Router is implemented by handlers which can tell which route template a
+// request was matched against.
+type Router interface {
+	Route(r *http.Request) (string, bool)
+}
+
+// Routes is implemented by handlers which declare their route templates,
+// e.g. "/users/{id}", "/users/:id" or "/static/*".
+type Routes interface {
+	Routes() []string
+}
+
+type segment struct {
+	literal string
+	param   bool
+	rest    bool
+}
+
+type template struct {
+	route    string
+	segments []segment
+	literals int
+}
+
+func parseTemplate(route string) template {
+	t := template{route: route}
+	for _, part := range splitPath(route) {
+		switch {
+		case part == "*" || (strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}")):
+			t.segments = append(t.segments, segment{rest: true})
+		case strings.HasPrefix(part, ":") || (strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")):
+			t.segments = append(t.segments, segment{param: true})
+		default:
+			t.segments = append(t.segments, segment{literal: part})
+			t.literals++
+		}
+	}
+	return t
+}
+
+func (t template) match(parts []string) bool {
+	for i, s := range t.segments {
+		if s.rest {
+			return true
+		}
+		if i >= len(parts) {
+			return false
+		}
+		if !s.param && s.literal != parts[i] {
+			return false
+		}
+	}
+	return len(parts) == len(t.segments)
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+type templateRouter []template
+
+func (t templateRouter) Route(r *http.Request) (string, bool) {
+	parts := splitPath(r.URL.Path)
+	for _, tmpl := range t {
+		if tmpl.match(parts) {
+			return tmpl.route, true
+		}
+	}
+	return "", false
+}
+
+func newTemplateRouter(routes []string) templateRouter {
+	out := make(templateRouter, 0, len(routes))
+	for _, route := range routes {
+		out = append(out, parseTemplate(route))
+	}
+
+	// most literal segments first so "/users/me" wins over "/users/{id}".
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].literals != out[j].literals {
+			return out[i].literals > out[j].literals
+		}
+		return len(out[i].segments) > len(out[j].segments)
+	})
+	return out
+}
+
+type muxRouter struct {
+	mux *http.ServeMux
+}
+
+func (m muxRouter) Route(r *http.Request) (string, bool) {
+	_, pattern := m.mux.Handler(r)
+	return pattern, pattern != ""
+}
+
+type catchAllRouter struct{}
+
+func (catchAllRouter) Route(r *http.Request) (string, bool) {
+	return CatchAllRoute, true
+}
+
+// NewRouter picks the best way of resolving route templates for a handler.
+// Handlers without any routes get CatchAllRoute.
+func NewRouter(h http.Handler) Router {
+	switch router := h.(type) {
+	case Router:
+		return router
+	case Routes:
+		return newTemplateRouter(router.Routes())
+	case *http.ServeMux:
+		return muxRouter{router}
+	default:
+		return catchAllRouter{}
+	}
+}
+
+type routeLabeler struct {
+	router Router
+	routes *metrics.BoundedLabel
+}
+
+// Label returns the route for a request, collapsing anything unknown or
+// above the limit of distinct routes into OtherRoute.
+func (l *routeLabeler) Label(r *http.Request) string {
+	route, ok := l.router.Route(r)
+	if !ok || route == "" {
+		return OtherRoute
+	}
+	return l.routes.Label(route)
+}
+
+func newRouteLabeler(router Router, max int) *routeLabeler {
+	return &routeLabeler{
+		router: router,
+		routes: metrics.NewBoundedLabel(max, OtherRoute),
+	}
+}
+
+type routeKey struct{}
+
+// withRoute works out the route of every request once, from the function
+// handler, so all the middleware in between label by the same route and
+// share one limit.
+func withRoute(routes *routeLabeler, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), routeKey{}, routes.Label(r))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RouteFromContext returns the route label of the request being served.
+func RouteFromContext(ctx context.Context) string {
+	if route, ok := ctx.Value(routeKey{}).(string); ok {
+		return route
+	}
+	return CatchAllRoute
+}
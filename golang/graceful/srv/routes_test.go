@@ -0,0 +1,67 @@
+package srv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type declaredRoutes struct {
+	http.Handler
+}
+
+func (declaredRoutes) Routes() []string {
+	return []string{"/users/{id}", "/users/me", "/static/*", "/orders/:id/items"}
+}
+
+func TestRouteLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		want    string
+	}{
+		{"template", declaredRoutes{}, "/users/42", "/users/{id}"},
+		{"literal wins", declaredRoutes{}, "/users/me", "/users/me"},
+		{"rest", declaredRoutes{}, "/static/css/site.css", "/static/*"},
+		{"colon param", declaredRoutes{}, "/orders/7/items", "/orders/:id/items"},
+		{"no template", declaredRoutes{}, "/nope", OtherRoute},
+		{"mux", mux, "/users/42", "/users/"},
+		{"mux no match", mux, "/nope", OtherRoute},
+		{"no routes", http.NotFoundHandler(), "/users/42", CatchAllRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			routes := newRouteLabeler(NewRouter(tt.handler), 10)
+			h := withRoute(routes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RouteFromContext(r.Context())
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got != tt.want {
+				t.Errorf("route = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteLimit(t *testing.T) {
+	routes := newRouteLabeler(NewRouter(declaredRoutes{}), 1)
+	label := func(path string) string {
+		return routes.Label(httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := label("/users/1"); got != "/users/{id}" {
+		t.Fatalf("route = %q", got)
+	}
+	if got := label("/static/a"); got != OtherRoute {
+		t.Errorf("route over the limit = %q, want %q", got, OtherRoute)
+	}
+	if got := label("/users/2"); got != "/users/{id}" {
+		t.Errorf("known route = %q", got)
+	}
+}
@@ -0,0 +1,256 @@
+package srv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+var samplingDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "trace_sampling_decisions_total",
+	Help: "Sampling decisions made for traces entering the process.",
+}, []string{"decision", "reason"})
+
+func init() {
+	prometheus.MustRegister(samplingDecisions)
+}
+
+// rateLimiter is a token bucket allowing limit traces a second with bursts
+// of up to a second's worth, or of one trace when limit is below one.
+type rateLimiter struct {
+	limit float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.limit
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func newRateLimiter(limit float64) *rateLimiter {
+	burst := math.Max(limit, 1)
+	return &rateLimiter{limit: limit, burst: burst, tokens: burst, last: time.Now()}
+}
+
+type routeRule struct {
+	route   string
+	sampler sdktrace.Sampler
+}
+
+type statusRule struct {
+	route   string
+	status  string
+	sampler sdktrace.Sampler
+}
+
+// matchStatus matches a code against 500 or a class like 5xx.
+func matchStatus(pattern string, code int64) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasSuffix(pattern, "xx") && len(pattern) == 3 {
+		return strconv.FormatInt(code/100, 10) == pattern[:1]
+	}
+	return pattern == strconv.FormatInt(code, 10)
+}
+
+// matchRules finds the first rule matching the route and status of a span
+// and reports whether it samples the trace. A rule without a route or a
+// status matches any.
+func matchRules(rules []statusRule, s sdktrace.ReadOnlySpan) bool {
+	var code int64
+	route := ""
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case semconv.HTTPStatusCodeKey:
+			code = kv.Value.AsInt64()
+		case semconv.HTTPRouteKey:
+			route = kv.Value.AsString()
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.route != "" && rule.route != route {
+			continue
+		}
+		if rule.status != "" && !matchStatus(rule.status, code) {
+			continue
+		}
+		return rule.sampler.ShouldSample(sdktrace.SamplingParameters{TraceID: s.SpanContext().TraceID()}).Decision == sdktrace.RecordAndSample
+	}
+	return false
+}
+
+func stringAttribute(attrs []attribute.KeyValue, key attribute.Key) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// sampler makes the decision for spans entering the process, children of
+// local spans follow their parent. Spans which may still be kept by a
+// status rule are recorded but not sampled until they end.
+type sampler struct {
+	parentBased bool
+	ratio       sdktrace.Sampler
+	routes      []routeRule
+	statuses    []statusRule
+	excluded    map[string]struct{}
+	limiter     *rateLimiter
+}
+
+func (s *sampler) decide(p sdktrace.SamplingParameters, psc trace.SpanContext) (bool, string) {
+	if s.parentBased && psc.IsValid() {
+		return psc.IsSampled(), "parent"
+	}
+
+	route := stringAttribute(p.Attributes, semconv.HTTPRouteKey)
+	for _, rule := range s.routes {
+		if rule.route == route {
+			return rule.sampler.ShouldSample(p).Decision == sdktrace.RecordAndSample, "rule"
+		}
+	}
+	return s.ratio.ShouldSample(p).Decision == sdktrace.RecordAndSample, "ratio"
+}
+
+func (s *sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	result := sdktrace.SamplingResult{Tracestate: psc.TraceState()}
+
+	if psc.IsValid() && !psc.IsRemote() {
+		if psc.IsSampled() {
+			result.Decision = sdktrace.RecordAndSample
+		}
+		return result
+	}
+
+	path, _, _ := strings.Cut(stringAttribute(p.Attributes, semconv.HTTPTargetKey), "?")
+	if _, ok := s.excluded[path]; ok {
+		samplingDecisions.WithLabelValues("dropped", "excluded").Inc()
+		return result
+	}
+
+	sampled, reason := s.decide(p, psc)
+	if sampled && s.limiter != nil && !s.limiter.Allow() {
+		sampled, reason = false, "rate_limit"
+	}
+
+	switch {
+	case sampled:
+		result.Decision = sdktrace.RecordAndSample
+		samplingDecisions.WithLabelValues("sampled", reason).Inc()
+	case len(s.statuses) > 0:
+		result.Decision = sdktrace.RecordOnly
+		samplingDecisions.WithLabelValues("recorded", reason).Inc()
+	default:
+		samplingDecisions.WithLabelValues("dropped", reason).Inc()
+	}
+	return result
+}
+
+func (s *sampler) Description() string {
+	return "GracefulSampler"
+}
+
+// sampledSpan marks a recorded span as sampled so the exporter keeps it.
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	return s.ReadOnlySpan.SpanContext().WithTraceFlags(trace.FlagsSampled)
+}
+
+// statusProcessor keeps the recorded spans matching a status rule once
+// their status is known.
+type statusProcessor struct {
+	sdktrace.SpanProcessor
+	rules []statusRule
+}
+
+func (p *statusProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+
+	if matchRules(p.rules, s) {
+		samplingDecisions.WithLabelValues("sampled", "status").Inc()
+		p.SpanProcessor.OnEnd(sampledSpan{s})
+	}
+}
+
+func validRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("sampling ratio must be between 0 and 1: %v", ratio)
+	}
+	return nil
+}
+
+// NewSampler builds the sampler and, when there are status rules, wraps the
+// processor so matching spans are kept.
+func NewSampler(cfg config.SamplingConfig, processor sdktrace.SpanProcessor) (sdktrace.Sampler, sdktrace.SpanProcessor, error) {
+	if err := validRatio(cfg.Ratio); err != nil {
+		return nil, nil, err
+	}
+
+	s := &sampler{
+		parentBased: cfg.ParentBased,
+		ratio:       sdktrace.TraceIDRatioBased(cfg.Ratio),
+		excluded:    make(map[string]struct{}, len(cfg.ExcludedPaths)),
+	}
+	for _, path := range cfg.ExcludedPaths {
+		s.excluded[path] = struct{}{}
+	}
+	if cfg.RateLimit > 0 {
+		s.limiter = newRateLimiter(cfg.RateLimit)
+	}
+
+	for _, rule := range cfg.Rules {
+		if err := validRatio(rule.Ratio); err != nil {
+			return nil, nil, err
+		}
+		if rule.Status != "" {
+			s.statuses = append(s.statuses, statusRule{rule.Route, rule.Status, sdktrace.TraceIDRatioBased(rule.Ratio)})
+			continue
+		}
+		if rule.Route == "" {
+			return nil, nil, fmt.Errorf("sampling rule needs a route or a status")
+		}
+		s.routes = append(s.routes, routeRule{rule.Route, sdktrace.TraceIDRatioBased(rule.Ratio)})
+	}
+
+	if len(s.statuses) > 0 {
+		processor = &statusProcessor{SpanProcessor: processor, rules: s.statuses}
+	}
+	return s, processor, nil
+}
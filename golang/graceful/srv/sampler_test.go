@@ -0,0 +1,221 @@
+package srv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func remoteParent(sampled bool) context.Context {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+	if sampled {
+		sc = sc.WithTraceFlags(trace.FlagsSampled)
+	}
+	return trace.ContextWithRemoteSpanContext(context.Background(), sc)
+}
+
+func TestShouldSample(t *testing.T) {
+	users := config.SamplingRule{Route: "/users/{id}", Ratio: 1}
+	tests := map[string]struct {
+		cfg      config.SamplingConfig
+		parent   context.Context
+		attrs    []attribute.KeyValue
+		want     sdktrace.SamplingDecision
+		decision string
+		reason   string
+	}{
+		"ratio": {
+			cfg:      config.SamplingConfig{Ratio: 1},
+			want:     sdktrace.RecordAndSample,
+			decision: "sampled",
+			reason:   "ratio",
+		},
+		"route rule": {
+			cfg:      config.SamplingConfig{Rules: []config.SamplingRule{users}},
+			attrs:    []attribute.KeyValue{semconv.HTTPRouteKey.String("/users/{id}")},
+			want:     sdktrace.RecordAndSample,
+			decision: "sampled",
+			reason:   "rule",
+		},
+		"other route": {
+			cfg:      config.SamplingConfig{Rules: []config.SamplingRule{users}},
+			attrs:    []attribute.KeyValue{semconv.HTTPRouteKey.String("/orders")},
+			want:     sdktrace.Drop,
+			decision: "dropped",
+			reason:   "ratio",
+		},
+		"sampled parent": {
+			cfg:      config.SamplingConfig{ParentBased: true},
+			parent:   remoteParent(true),
+			want:     sdktrace.RecordAndSample,
+			decision: "sampled",
+			reason:   "parent",
+		},
+		"unsampled parent": {
+			cfg:      config.SamplingConfig{ParentBased: true, Ratio: 1},
+			parent:   remoteParent(false),
+			want:     sdktrace.Drop,
+			decision: "dropped",
+			reason:   "parent",
+		},
+		"parent ignored": {
+			cfg:      config.SamplingConfig{Ratio: 1},
+			parent:   remoteParent(false),
+			want:     sdktrace.RecordAndSample,
+			decision: "sampled",
+			reason:   "ratio",
+		},
+		"excluded path": {
+			cfg:      config.SamplingConfig{Ratio: 1, ExcludedPaths: []string{"/health"}},
+			attrs:    []attribute.KeyValue{semconv.HTTPTargetKey.String("/health?verbose")},
+			want:     sdktrace.Drop,
+			decision: "dropped",
+			reason:   "excluded",
+		},
+		"status rule": {
+			cfg:      config.SamplingConfig{Rules: []config.SamplingRule{{Status: "5xx", Ratio: 1}}},
+			want:     sdktrace.RecordOnly,
+			decision: "recorded",
+			reason:   "ratio",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, _, err := NewSampler(tt.cfg, sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parent := tt.parent
+			if parent == nil {
+				parent = context.Background()
+			}
+
+			counter := samplingDecisions.WithLabelValues(tt.decision, tt.reason)
+			before := testutil.ToFloat64(counter)
+			result := s.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: parent,
+				TraceID:       trace.TraceID{2},
+				Name:          "GET",
+				Kind:          trace.SpanKindServer,
+				Attributes:    tt.attrs,
+			})
+			if result.Decision != tt.want {
+				t.Errorf("decision = %v, want %v", result.Decision, tt.want)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("%s/%s decisions counted %v times, want 1", tt.decision, tt.reason, got)
+			}
+		})
+	}
+}
+
+func TestShouldSampleLocalParent(t *testing.T) {
+	s, processor, err := NewSampler(config.SamplingConfig{Ratio: 1}, sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(s), sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+
+	// children follow the local parent whatever the rules say.
+	ctx, parent := tp.Tracer("test").Start(remoteParent(false), "parent")
+	defer parent.End()
+	s.(*sampler).ratio = sdktrace.NeverSample()
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	defer child.End()
+	if !child.SpanContext().IsSampled() {
+		t.Error("child of a sampled local parent isn't sampled")
+	}
+}
+
+func TestStatusProcessor(t *testing.T) {
+	cfg := config.SamplingConfig{Rules: []config.SamplingRule{
+		{Route: "/orders", Status: "503", Ratio: 1},
+		{Status: "5xx", Ratio: 0},
+	}}
+	exporter := tracetest.NewInMemoryExporter()
+	s, processor, err := NewSampler(cfg, sdktrace.NewSimpleSpanProcessor(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(s), sdktrace.WithSpanProcessor(processor))
+	defer tp.Shutdown(context.Background())
+
+	before := testutil.ToFloat64(samplingDecisions.WithLabelValues("sampled", "status"))
+	end := func(name string, route string, code int) {
+		_, span := tp.Tracer("test").Start(context.Background(), name)
+		if !span.IsRecording() {
+			t.Fatalf("%s isn't recorded", name)
+		}
+		span.SetAttributes(semconv.HTTPRouteKey.String(route), semconv.HTTPStatusCodeKey.Int(code))
+		span.End()
+	}
+	end("kept", "/orders", 503)
+	end("ok", "/orders", 200)
+	end("other route", "/users", 503)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Fatalf("exported %d spans, want the 503 on /orders", len(spans))
+	}
+	if !spans[0].SpanContext.IsSampled() {
+		t.Error("kept span isn't marked sampled")
+	}
+	if got := testutil.ToFloat64(samplingDecisions.WithLabelValues("sampled", "status")) - before; got != 1 {
+		t.Errorf("status decisions = %v, want 1", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := map[string]struct {
+		limit float64
+		burst int
+		wait  time.Duration
+	}{
+		"per second":  {limit: 5, burst: 5, wait: 200 * time.Millisecond},
+		"below one":   {limit: 0.5, burst: 1, wait: 2 * time.Second},
+		"one an hour": {limit: 1.0 / 3600, burst: 1, wait: time.Hour},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			l := newRateLimiter(tt.limit)
+			for i := 0; i < tt.burst; i++ {
+				if !l.Allow() {
+					t.Fatalf("trace %d of the burst refused", i)
+				}
+			}
+			if l.Allow() {
+				t.Fatal("allowed past the burst")
+			}
+
+			// wind the clock back rather than sleep.
+			l.last = l.last.Add(-tt.wait)
+			if !l.Allow() {
+				t.Errorf("refused after %s", tt.wait)
+			}
+			l.last = l.last.Add(-10 * tt.wait)
+			allowed := 0
+			for l.Allow() {
+				allowed++
+			}
+			if allowed != tt.burst {
+				t.Errorf("allowed %d after a long wait, want the burst of %d", allowed, tt.burst)
+			}
+		})
+	}
+}
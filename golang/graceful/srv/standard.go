@@ -0,0 +1,104 @@
+package srv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+	"github.com/slok/go-http-metrics/middleware"
+)
+
+// statusWriter remembers the status and size written for the metrics,
+// span and logs of a request.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer is not a http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+// routeReporter tells the metrics middleware about a request.
+type routeReporter struct {
+	w *statusWriter
+	r *http.Request
+}
+
+func (s *routeReporter) Method() string { return s.r.Method }
+
+func (s *routeReporter) Context() context.Context { return s.r.Context() }
+
+func (s *routeReporter) URLPath() string { return s.r.URL.Path }
+
+func (s *routeReporter) StatusCode() int { return s.w.status }
+
+func (s *routeReporter) BytesWritten() int64 { return s.w.size }
+
+type standard struct {
+	server *http.Server
+}
+
+func (s *standard) Start(ctx context.Context) error {
+	// Run the server
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *standard) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// WithMetricsRecorder records the request metrics on reg, with the trace
+// as an exemplar on the latency, and with every extra recorder, e.g. the one
+// of a Meter.
+func WithMetricsRecorder(reg prometheus.Registerer, h http.Handler, recorders ...httpmetrics.Recorder) http.Handler {
+	recorder := append(multiRecorder{newPromRecorder(reg)}, recorders...)
+
+	// Create our middleware.
+	mdlw := middleware.New(middleware.Config{
+		Recorder: recorder,
+	})
+
+	// Label by route template rather than the URL so ids in the path don't
+	// create a new series per request.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mdlw.Measure(RouteFromContext(r.Context()), &routeReporter{w: sw, r: r}, func() {
+			h.ServeHTTP(sw, r)
+		})
+	})
+}
+
+func NewStandard(addr string, h http.Handler) Startable {
+	server := &http.Server{Addr: addr, Handler: h}
+	return &standard{server}
+}
@@ -0,0 +1,49 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+type Startable interface {
+	Start(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// newHandler wraps the function handler in the server middleware, which
+// all label by the route the function handler resolves.
+func newHandler(cfg *config.Config, h http.Handler, recorders ...httpmetrics.Recorder) (http.Handler, error) {
+	handler, err := WithCapture(cfg, WithMetricsRecorder(prometheus.DefaultRegisterer, WithColdStart(h), recorders...))
+	if err != nil {
+		return nil, err
+	}
+	handler, err = WithAccessLog(cfg, WithLogging(cfg, handler))
+	if err != nil {
+		return nil, err
+	}
+	handler = WithTracing(cfg, WithBaggage(cfg, handler))
+
+	routes := newRouteLabeler(NewRouter(h), cfg.Metrics.MaxRoutes)
+	return withRoute(routes, handler), nil
+}
+
+func NewStartable(cfg *config.Config, h interface{}, recorders ...httpmetrics.Recorder) (Startable, error) {
+	switch start := h.(type) {
+	case Startable:
+		return start, nil
+	case http.Handler:
+		handler, err := newHandler(cfg, start, recorders...)
+		if err != nil {
+			return nil, err
+		}
+		return NewStandard(cfg.SrvAddr, handler), nil
+	default:
+		return nil, fmt.Errorf("unknown service type: %T", h)
+	}
+}
@@ -0,0 +1,117 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	startupPhaseDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "startup_phase_duration_seconds",
+		Help: "Time taken by each phase of starting the process.",
+	}, []string{"phase"})
+	startupDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "startup_duration_seconds",
+		Help: "Time from the process starting until it was ready to serve.",
+	})
+	coldStarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cold_start_requests_total",
+		Help: "Number of requests which were the first served by their process.",
+	})
+	firstRequestLatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cold_start_first_request_seconds",
+		Help: "Time from the process starting until the first request was served.",
+	})
+)
+
+// processStart is as close to exec as we can get without reading /proc.
+var processStart = time.Now()
+
+func init() {
+	prometheus.MustRegister(startupPhaseDuration, startupDuration, coldStarts, firstRequestLatency)
+}
+
+type startupPhase struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Startup times the phases of bringing the process up so scale from zero
+// latency can be tuned.
+type Startup struct {
+	start time.Time
+
+	mu     sync.Mutex
+	phases []startupPhase
+	ready  time.Time
+}
+
+// Phase starts timing a phase, call the returned func when it is done.
+func (s *Startup) Phase(name string) func() {
+	start := time.Now()
+	return func() {
+		end := time.Now()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.phases = append(s.phases, startupPhase{Name: name, Start: start, End: end, Duration: end.Sub(start)})
+		startupPhaseDuration.WithLabelValues(name).Set(end.Sub(start).Seconds())
+	}
+}
+
+// Report records the total startup time and a startup span with a child
+// per phase. Call it once the tracer is installed so the span is exported.
+func (s *Startup) Report(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ready = time.Now()
+	startupDuration.Set(s.ready.Sub(s.start).Seconds())
+
+	tracer := otel.Tracer(instrumentationName)
+	ctx, span := tracer.Start(ctx, "startup", trace.WithTimestamp(s.start))
+	for _, p := range s.phases {
+		_, child := tracer.Start(ctx, p.Name, trace.WithTimestamp(p.Start))
+		child.End(trace.WithTimestamp(p.End))
+	}
+	span.End(trace.WithTimestamp(s.ready))
+}
+
+// Phases returns the timed phases for the health report.
+func (s *Startup) Phases() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]startupPhase{}, s.phases...)
+}
+
+func NewStartup() *Startup {
+	return &Startup{start: processStart}
+}
+
+// WithColdStart flags the first request served by the process as a cold
+// start on its span and in the metrics.
+func WithColdStart(h http.Handler) http.Handler {
+	var served atomic.Bool
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cold := served.CompareAndSwap(false, true)
+		trace.SpanFromContext(r.Context()).SetAttributes(semconv.FaaSColdstartKey.Bool(cold))
+
+		h.ServeHTTP(w, r)
+
+		if cold {
+			coldStarts.Inc()
+			firstRequestLatency.Set(time.Since(processStart).Seconds())
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartupReport(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	s := &Startup{start: time.Now()}
+	done := s.Phase("config")
+	time.Sleep(10 * time.Millisecond)
+	done()
+	s.Phase("handler")()
+
+	if got := testutil.ToFloat64(startupPhaseDuration.WithLabelValues("config")); got < 0.01 {
+		t.Errorf("config phase took %vs, want at least 10ms", got)
+	}
+	phases := s.Phases().([]startupPhase)
+	if len(phases) != 2 || phases[0].Name != "config" || phases[1].Name != "handler" {
+		t.Fatalf("phases = %+v", phases)
+	}
+
+	s.Report(context.Background())
+	if got := testutil.ToFloat64(startupDuration); got < 0.01 {
+		t.Errorf("startup took %vs, want at least 10ms", got)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("%d spans, want startup and a child per phase", len(spans))
+	}
+	var root tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "startup" {
+			root = span
+		}
+	}
+	if !root.StartTime.Equal(s.start) {
+		t.Errorf("startup span starts at %v, want the process start %v", root.StartTime, s.start)
+	}
+	for _, span := range spans {
+		if span.Name == "startup" {
+			continue
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s isn't a child of the startup span", span.Name)
+		}
+		if span.Name == "config" && !span.StartTime.Equal(phases[0].Start) {
+			t.Errorf("config span starts at %v, want %v", span.StartTime, phases[0].Start)
+		}
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	h := WithColdStart(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() bool {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		defer span.End()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+		for _, kv := range span.(sdktrace.ReadOnlySpan).Attributes() {
+			if kv.Key == semconv.FaaSColdstartKey {
+				return kv.Value.AsBool()
+			}
+		}
+		t.Fatal("cold start attribute missing")
+		return false
+	}
+
+	before := testutil.ToFloat64(coldStarts)
+	if !serve() {
+		t.Error("first request not flagged as a cold start")
+	}
+	first := testutil.ToFloat64(firstRequestLatency)
+	if first <= 0 {
+		t.Errorf("first request latency = %v", first)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if serve() {
+		t.Error("second request flagged as a cold start")
+	}
+	if got := testutil.ToFloat64(firstRequestLatency); got != first {
+		t.Errorf("first request latency changed from %v to %v", first, got)
+	}
+	if got := testutil.ToFloat64(coldStarts) - before; got != 1 {
+		t.Errorf("cold starts = %v, want 1", got)
+	}
+}
@@ -0,0 +1,391 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+	"go.uber.org/zap"
+
+	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/platform"
+)
+
+// maxPacketSize keeps datagrams under the usual internet MTU.
+const maxPacketSize = 1432
+
+type tag struct {
+	name  string
+	value string
+}
+
+type timing struct {
+	count int64
+	sum   float64
+	max   float64
+}
+
+// statsd aggregates metrics in memory and pushes them to a StatsD or
+// DogStatsD agent every interval.
+type statsd struct {
+	conn     net.Conn
+	dog      bool
+	prefix   string
+	tags     []tag
+	interval time.Duration
+	gatherer prometheus.Gatherer
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	timings  map[string]*timing
+
+	// last values of the gathered counters, to push the change since the
+	// previous flush.
+	previous map[string]float64
+	numGC    uint32
+	pauseNs  uint64
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *statsd) Start(ctx context.Context) error {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				zap.L().Warn("statsd: flush failed", zap.Error(err))
+			}
+		case <-s.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *statsd) Shutdown(ctx context.Context) error {
+	s.once.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+
+	err := s.flush()
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *statsd) ObserveHTTPRequestDuration(_ context.Context, props httpmetrics.HTTPReqProperties, duration time.Duration) {
+	s.timing("http.request.duration", float64(duration)/float64(time.Millisecond),
+		tag{"handler", props.ID}, tag{"method", props.Method}, tag{"code", props.Code})
+}
+
+func (s *statsd) ObserveHTTPResponseSize(_ context.Context, props httpmetrics.HTTPReqProperties, sizeBytes int64) {
+	s.count("http.response.size", sizeBytes,
+		tag{"handler", props.ID}, tag{"method", props.Method}, tag{"code", props.Code})
+}
+
+func (s *statsd) AddInflightRequests(_ context.Context, props httpmetrics.HTTPProperties, quantity int) {
+	key := s.key("http.requests.inflight", []tag{{"handler", props.ID}})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[key] += float64(quantity)
+}
+
+func (s *statsd) count(name string, value int64, tags ...tag) {
+	key := s.key(name, tags)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key] += float64(value)
+}
+
+func (s *statsd) gauge(name string, value float64, tags ...tag) {
+	key := s.key(name, tags)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[key] = value
+}
+
+func (s *statsd) timing(name string, value float64, tags ...tag) {
+	key := s.key(name, tags)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.timings[key]
+	if !ok {
+		t = &timing{}
+		s.timings[key] = t
+	}
+	t.count++
+	t.sum += value
+	if value > t.max {
+		t.max = value
+	}
+}
+
+// key renders the metric name and tags in the wire format, minus the value.
+// DogStatsD gets real tags, plain StatsD gets the tag values folded into the
+// metric name.
+func (s *statsd) key(name string, tags []tag) string {
+	var sb strings.Builder
+	sb.WriteString(s.prefix)
+	sb.WriteString(name)
+
+	if !s.dog {
+		for _, t := range tags {
+			sb.WriteByte('.')
+			sb.WriteString(sanitizeStatsdName(t.value))
+		}
+		return sb.String()
+	}
+
+	all := append(append([]tag{}, s.tags...), tags...)
+	for i, t := range all {
+		if i == 0 {
+			sb.WriteString("|#")
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(sanitizeStatsd(t.name))
+		sb.WriteByte(':')
+		sb.WriteString(sanitizeStatsd(t.value))
+	}
+	return sb.String()
+}
+
+func (s *statsd) collectRuntime() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	s.gauge("runtime.goroutines", float64(runtime.NumGoroutine()))
+	s.gauge("runtime.heap.alloc", float64(ms.HeapAlloc))
+	s.gauge("runtime.heap.inuse", float64(ms.HeapInuse))
+	s.gauge("runtime.sys", float64(ms.Sys))
+	s.count("runtime.gc.count", int64(ms.NumGC-s.numGC))
+	s.count("runtime.gc.pause_ns", int64(ms.PauseTotalNs-s.pauseNs))
+
+	s.numGC = ms.NumGC
+	s.pauseNs = ms.PauseTotalNs
+}
+
+// collectGathered turns the function metrics into statsd metrics. Counters
+// and histograms are pushed as the change since the last flush.
+func (s *statsd) collectGathered() error {
+	if s.gatherer == nil {
+		return nil
+	}
+
+	families, err := s.gatherer.Gather()
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			tags := make([]tag, 0, len(m.GetLabel()))
+			for _, pair := range m.GetLabel() {
+				// the registry labels are already part of every metric.
+				if pair.GetName() == "environment" || pair.GetName() == "version" {
+					continue
+				}
+				tags = append(tags, tag{pair.GetName(), pair.GetValue()})
+			}
+
+			name := family.GetName()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				s.countDelta(name, m.GetCounter().GetValue(), tags)
+			case dto.MetricType_GAUGE:
+				s.gauge(name, m.GetGauge().GetValue(), tags...)
+			case dto.MetricType_UNTYPED:
+				s.gauge(name, m.GetUntyped().GetValue(), tags...)
+			case dto.MetricType_HISTOGRAM:
+				s.countDelta(name+".count", float64(m.GetHistogram().GetSampleCount()), tags)
+				s.countDelta(name+".sum", m.GetHistogram().GetSampleSum(), tags)
+			case dto.MetricType_SUMMARY:
+				s.countDelta(name+".count", float64(m.GetSummary().GetSampleCount()), tags)
+				s.countDelta(name+".sum", m.GetSummary().GetSampleSum(), tags)
+			}
+		}
+	}
+	return err
+}
+
+func (s *statsd) countDelta(name string, value float64, tags []tag) {
+	key := s.key(name, tags)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delta := value - s.previous[key]
+	if delta < 0 {
+		// the counter was reset.
+		delta = value
+	}
+	s.previous[key] = value
+	s.counters[key] += delta
+}
+
+// flush sends everything aggregated since the last flush.
+func (s *statsd) flush() error {
+	s.collectRuntime()
+	gatherErr := s.collectGathered()
+
+	s.mu.Lock()
+	lines := make([]string, 0, len(s.counters)+len(s.gauges)+3*len(s.timings))
+	for key, value := range s.counters {
+		lines = append(lines, line(key, strconv.FormatFloat(value, 'f', -1, 64), "c"))
+	}
+	for key, value := range s.gauges {
+		lines = append(lines, line(key, strconv.FormatFloat(value, 'f', -1, 64), "g"))
+	}
+	for key, t := range s.timings {
+		name, tags := splitKey(key)
+		lines = append(lines,
+			line(name+".count"+tags, strconv.FormatInt(t.count, 10), "c"),
+			line(name+".avg"+tags, strconv.FormatFloat(t.sum/float64(t.count), 'f', 3, 64), "g"),
+			line(name+".max"+tags, strconv.FormatFloat(t.max, 'f', 3, 64), "g"),
+		)
+	}
+	s.counters = make(map[string]float64)
+	s.timings = make(map[string]*timing)
+	s.mu.Unlock()
+
+	sort.Strings(lines)
+	if err := s.send(lines); err != nil {
+		return err
+	}
+	return gatherErr
+}
+
+func (s *statsd) send(lines []string) error {
+	var packet strings.Builder
+	for _, l := range lines {
+		if packet.Len() > 0 && packet.Len()+len(l)+1 > maxPacketSize {
+			if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(l)
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err := s.conn.Write([]byte(packet.String()))
+	return err
+}
+
+// line puts the value and type between the name and the tags.
+func line(key string, value string, kind string) string {
+	name, tags := splitKey(key)
+	return name + ":" + value + "|" + kind + tags
+}
+
+func splitKey(key string) (string, string) {
+	if i := strings.Index(key, "|#"); i >= 0 {
+		return key[:i], key[i:]
+	}
+	return key, ""
+}
+
+func sanitizeStatsd(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '@', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// sanitizeStatsdName makes a tag value safe to fold into a metric name, where
+// dots and slashes would start new segments of the name.
+func sanitizeStatsdName(s string) string {
+	s = strings.TrimPrefix(s, "/")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '/':
+			return '_'
+		}
+		return r
+	}, sanitizeStatsd(s))
+}
+
+// platformTags are the Datadog kubernetes tags which are known.
+func platformTags(m platform.Metadata) []tag {
+	var tags []tag
+	add := func(name string, value string) {
+		if value != "" {
+			tags = append(tags, tag{name, value})
+		}
+	}
+	add("kube_namespace", m.PodNamespace)
+	add("pod_name", m.PodName)
+	add("kube_node", m.NodeName)
+	add("kube_container_name", m.ContainerName)
+	add("function_name", m.FunctionName)
+	return tags
+}
+
+// NewStatsd pushes the request, runtime and gathered metrics over UDP to a
+// StatsD agent, or a DogStatsD agent with tags when dog is set.
+func NewStatsd(cfg *config.Config, dog bool, gatherer prometheus.Gatherer) (Meter, error) {
+	addr := cfg.Metrics.Url
+	if addr == "" {
+		addr = "127.0.0.1:8125"
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd dial: %w", err)
+	}
+
+	interval := cfg.Metrics.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	s := &statsd{
+		conn:     conn,
+		dog:      dog,
+		interval: interval,
+		gatherer: gatherer,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		timings:  make(map[string]*timing),
+		previous: make(map[string]float64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if dog {
+		s.tags = []tag{{"service", cfg.ServiceName}, {"env", cfg.Environment}, {"version", cfg.Version}}
+		s.tags = append(s.tags, platformTags(platform.Detect())...)
+	} else {
+		s.prefix = sanitizeStatsd(cfg.ServiceName) + "."
+	}
+
+	return s, nil
+}
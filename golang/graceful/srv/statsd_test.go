@@ -0,0 +1,147 @@
+package srv
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	httpmetrics "github.com/slok/go-http-metrics/metrics"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// readLines reads the datagrams the agent gets until it goes quiet.
+func readLines(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	var lines []string
+	buf := make([]byte, 2*maxPacketSize)
+	timeout := 5 * time.Second
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > maxPacketSize {
+			t.Errorf("packet of %d bytes", n)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		timeout = 200 * time.Millisecond
+	}
+	if len(lines) == 0 {
+		t.Fatal("nothing sent")
+	}
+	return lines
+}
+
+func TestStatsd(t *testing.T) {
+	tests := map[string]struct {
+		dog  bool
+		want []string
+	}{
+		"statsd": {
+			want: []string{
+				"orders.http.request.duration.users.GET.200.count:2|c",
+				"orders.http.request.duration.users.GET.200.avg:20.000|g",
+				"orders.http.request.duration.users.GET.200.max:30.000|g",
+				"orders.http.response.size.users.GET.200:300|c",
+				"orders.jobs_total:3|c",
+				"orders.job_seconds.count:10|c",
+				"orders.job_seconds.sum:2.5|c",
+				"orders.payload_ratio.count:2|c",
+				"orders.payload_ratio.sum:0.75|c",
+				"orders.calls_total.v1_2_users:1|c",
+			},
+		},
+		"dogstatsd": {
+			dog: true,
+			want: []string{
+				"http.request.duration.count:2|c|#service:orders,env:test,version:1.0.0",
+				"http.request.duration.avg:20.000|g|#service:orders,env:test,version:1.0.0",
+				"http.request.duration.max:30.000|g|#service:orders,env:test,version:1.0.0",
+				"http.response.size:300|c|#service:orders,env:test,version:1.0.0",
+				"jobs_total:3|c|#service:orders,env:test,version:1.0.0",
+				"job_seconds.count:10|c|#service:orders,env:test,version:1.0.0",
+				"job_seconds.sum:2.5|c|#service:orders,env:test,version:1.0.0",
+				"payload_ratio.count:2|c|#service:orders,env:test,version:1.0.0",
+				"payload_ratio.sum:0.75|c|#service:orders,env:test,version:1.0.0",
+				"calls_total:1|c|#service:orders,env:test,version:1.0.0",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer agent.Close()
+
+			reg := prometheus.NewRegistry()
+			jobs := prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+			reg.MustRegister(jobs)
+			jobs.Add(3)
+			seconds := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "job_seconds"})
+			reg.MustRegister(seconds)
+			for i := 0; i < 10; i++ {
+				seconds.Observe(0.25)
+			}
+			ratio := prometheus.NewSummary(prometheus.SummaryOpts{Name: "payload_ratio"})
+			reg.MustRegister(ratio)
+			ratio.Observe(0.5)
+			ratio.Observe(0.25)
+			calls := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "calls_total"}, []string{"route"})
+			reg.MustRegister(calls)
+			calls.WithLabelValues("/v1.2/users").Inc()
+
+			cfg := &config.Config{
+				ServiceName: "orders",
+				Environment: "test",
+				Version:     "1.0.0",
+				Metrics:     config.MetricsConfig{Url: agent.LocalAddr().String(), Interval: time.Hour},
+			}
+			m, err := NewStatsd(cfg, tt.dog, reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go m.Start(context.Background())
+
+			ctx := context.Background()
+			props := httpmetrics.HTTPReqProperties{ID: "users", Method: http.MethodGet, Code: "200"}
+			m.ObserveHTTPRequestDuration(ctx, props, 10*time.Millisecond)
+			m.ObserveHTTPRequestDuration(ctx, props, 30*time.Millisecond)
+			m.ObserveHTTPResponseSize(ctx, props, 100)
+			m.ObserveHTTPResponseSize(ctx, props, 200)
+
+			// nothing goes out before the interval, Shutdown flushes.
+			if err := m.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+			lines := readLines(t, agent)
+
+			for _, want := range tt.want {
+				found := false
+				for _, l := range lines {
+					if l == want || tt.dog && strings.HasPrefix(l, want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("%q not sent, got:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+			if tt.dog {
+				for _, l := range lines {
+					if strings.HasPrefix(l, "http.") && !strings.HasSuffix(l, ",handler:users,method:GET,code:200") {
+						t.Errorf("request tags missing: %q", l)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package srv
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// DefaultTraceFile is where the file tracer writes when no url is set.
+const DefaultTraceFile = "traces.jsonl"
+
+// fileTracer closes the file once the tracer has flushed.
+type fileTracer struct {
+	Startable
+	file io.Closer
+}
+
+func (t *fileTracer) Shutdown(ctx context.Context) error {
+	err := t.Startable.Shutdown(ctx)
+	if cerr := t.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func newWriterTracer(w io.Writer, cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	opts := []stdouttrace.Option{stdouttrace.WithWriter(w)}
+	if cfg.Pretty {
+		opts = append(opts, stdouttrace.WithPrettyPrint())
+	}
+
+	exporter, err := stdouttrace.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, cfg, res)
+}
+
+// NewStdoutTracer writes spans to the console, handy for local runs and
+// go test.
+func NewStdoutTracer(cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	return newWriterTracer(os.Stdout, cfg, res)
+}
+
+// NewFileTracer writes spans to a rotating file which can be rendered with
+// cmd/traceview. The file holds one span per line, so Pretty only applies
+// to the console.
+func NewFileTracer(cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	cfg.Pretty = false
+
+	path := cfg.Url
+	if path == "" {
+		path = DefaultTraceFile
+	}
+
+	file, err := newRotatingFile(path, cfg.File.MaxSize, cfg.File.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	tracer, err := newWriterTracer(file, cfg, res)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileTracer{Startable: tracer, file: file}, nil
+}
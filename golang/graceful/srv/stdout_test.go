@@ -0,0 +1,45 @@
+package srv
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestFileTracerWritesLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	cfg := tracingConfig(path, "")
+	cfg.Pretty = true
+
+	tracer, err := NewFileTracer(cfg, resource.Empty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportSpan(t, tracer)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		var span struct{ Name string }
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("line %d is not a span: %v", lines, err)
+		}
+		if span.Name != "checkout" {
+			t.Errorf("span name = %q", span.Name)
+		}
+	}
+	if lines != 1 {
+		t.Errorf("got %d lines, want 1", lines)
+	}
+}
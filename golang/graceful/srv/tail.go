@@ -0,0 +1,311 @@
+package srv
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+var (
+	tailDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trace_tail_sampling_traces_total",
+		Help: "Traces decided by the tail sampler.",
+	}, []string{"decision", "reason"})
+	tailDroppedSpans = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "trace_tail_sampling_spans_dropped_total",
+		Help: "Spans dropped because their trace had too many buffered.",
+	})
+	tailBuffered = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "trace_tail_sampling_buffered_traces",
+		Help: "Traces waiting on their root span to end.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(tailDecisions, tailDroppedSpans, tailBuffered)
+}
+
+type tailTrace struct {
+	id    trace.TraceID
+	spans []sdktrace.ReadOnlySpan
+	start time.Time
+	elem  *list.Element
+}
+
+// defaultDecisionWait is how long a trace waits on its root, and its
+// decision is remembered, when there is no DecisionWait.
+const defaultDecisionWait = 30 * time.Second
+
+// tailSampler buffers the spans of each trace until its local root ends and
+// only then decides if the trace is passed on.
+type tailSampler struct {
+	sdktrace.SpanProcessor
+	cfg   config.TailSamplingConfig
+	ratio sdktrace.Sampler
+	rules []statusRule
+
+	mu        sync.Mutex
+	traces    map[trace.TraceID]*tailTrace
+	order     *list.List
+	decided   map[trace.TraceID]*decision
+	decisions *list.List
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
+
+func (p *tailSampler) remove(t *tailTrace) {
+	delete(p.traces, t.id)
+	p.order.Remove(t.elem)
+	tailBuffered.Set(float64(len(p.traces)))
+}
+
+// decide works out whether to keep a trace, root is nil when it never ended.
+func (p *tailSampler) decide(t *tailTrace, root sdktrace.ReadOnlySpan) (bool, string) {
+	for _, s := range t.spans {
+		if s.Status().Code == codes.Error {
+			return true, "error"
+		}
+	}
+	if root != nil {
+		if p.cfg.Latency > 0 && root.EndTime().Sub(root.StartTime()) >= p.cfg.Latency {
+			return true, "slow"
+		}
+		if matchRules(p.rules, root) {
+			return true, "rule"
+		}
+	}
+	return p.ratio.ShouldSample(sdktrace.SamplingParameters{TraceID: t.id}).Decision == sdktrace.RecordAndSample, "ratio"
+}
+
+// decision is what became of a trace, kept for a while for spans which end
+// after their local root.
+type decision struct {
+	id   trace.TraceID
+	keep bool
+	at   time.Time
+	elem *list.Element
+}
+
+type released struct {
+	t      *tailTrace
+	keep   bool
+	reason string
+}
+
+// settle decides on a trace taken out of the buffer and remembers the
+// decision, forgetting the oldest past MaxTraces. Called with mu held.
+func (p *tailSampler) settle(t *tailTrace, root sdktrace.ReadOnlySpan, now time.Time) released {
+	keep, reason := p.decide(t, root)
+
+	d := &decision{id: t.id, keep: keep, at: now}
+	d.elem = p.decisions.PushBack(d)
+	p.decided[t.id] = d
+	if p.cfg.MaxTraces > 0 && len(p.decided) > p.cfg.MaxTraces {
+		p.forget(p.decisions.Front().Value.(*decision))
+	}
+	return released{t: t, keep: keep, reason: reason}
+}
+
+func (p *tailSampler) forget(d *decision) {
+	delete(p.decided, d.id)
+	p.decisions.Remove(d.elem)
+}
+
+// release passes on the spans of a kept trace.
+func (p *tailSampler) release(r released) {
+	if !r.keep {
+		tailDecisions.WithLabelValues("dropped", r.reason).Inc()
+		return
+	}
+
+	tailDecisions.WithLabelValues("kept", r.reason).Inc()
+	for _, s := range r.t.spans {
+		p.SpanProcessor.OnEnd(s)
+	}
+}
+
+// wait is how long a trace waits on its root and how long its decision is
+// remembered for late spans.
+func (p *tailSampler) wait() time.Duration {
+	if p.cfg.DecisionWait > 0 {
+		return p.cfg.DecisionWait
+	}
+	return defaultDecisionWait
+}
+
+// expired settles the traces which waited too long on their root and
+// forgets old decisions. Called with mu held.
+func (p *tailSampler) expired(now time.Time) []released {
+	var out []released
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		t := e.Value.(*tailTrace)
+		if now.Sub(t.start) < p.wait() {
+			break
+		}
+		p.remove(t)
+		out = append(out, p.settle(t, nil, now))
+	}
+
+	for e := p.decisions.Front(); e != nil; e = p.decisions.Front() {
+		d := e.Value.(*decision)
+		if now.Sub(d.at) < p.wait() {
+			break
+		}
+		p.forget(d)
+	}
+	return out
+}
+
+func (p *tailSampler) evict(now time.Time) {
+	p.mu.Lock()
+	out := p.expired(now)
+	p.mu.Unlock()
+
+	for _, r := range out {
+		p.release(r)
+	}
+}
+
+func (p *tailSampler) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+
+	now := time.Now()
+	id := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	// a span ending after its root follows the decision on the trace.
+	if d, ok := p.decided[id]; ok {
+		p.mu.Unlock()
+		if d.keep {
+			p.SpanProcessor.OnEnd(s)
+		}
+		return
+	}
+
+	var out []released
+	t, ok := p.traces[id]
+	if !ok {
+		t = &tailTrace{id: id, start: now}
+		t.elem = p.order.PushBack(t)
+		p.traces[id] = t
+
+		// the oldest trace makes room and is decided on what it has.
+		if p.cfg.MaxTraces > 0 && len(p.traces) > p.cfg.MaxTraces {
+			oldest := p.order.Front().Value.(*tailTrace)
+			p.remove(oldest)
+			out = append(out, p.settle(oldest, nil, now))
+		}
+		tailBuffered.Set(float64(len(p.traces)))
+	}
+
+	// the root is always kept so a kept trace never loses it.
+	root := isLocalRoot(s)
+	if !root && p.cfg.MaxSpans > 0 && len(t.spans) >= p.cfg.MaxSpans {
+		tailDroppedSpans.Inc()
+	} else {
+		t.spans = append(t.spans, s)
+	}
+
+	if root {
+		p.remove(t)
+		out = append(out, p.settle(t, s, now))
+	}
+	p.mu.Unlock()
+
+	for _, r := range out {
+		p.release(r)
+	}
+}
+
+// flush decides on every buffered trace with the spans it has.
+func (p *tailSampler) flush() {
+	now := time.Now()
+
+	p.mu.Lock()
+	var out []released
+	for _, t := range p.traces {
+		out = append(out, p.settle(t, nil, now))
+	}
+	p.traces = map[trace.TraceID]*tailTrace{}
+	p.order.Init()
+	tailBuffered.Set(0)
+	p.mu.Unlock()
+
+	for _, r := range out {
+		p.release(r)
+	}
+}
+
+// Start settles the traces whose root doesn't end in time, even when no
+// other spans come along, until the sampler is shut down.
+func (p *tailSampler) Start(ctx context.Context) error {
+	interval := p.wait() / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.evict(now)
+		case <-p.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *tailSampler) ForceFlush(ctx context.Context) error {
+	p.flush()
+	return p.SpanProcessor.ForceFlush(ctx)
+}
+
+func (p *tailSampler) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+	p.flush()
+	return p.SpanProcessor.Shutdown(ctx)
+}
+
+// NewTailSampler puts a tail sampler in front of the processor exporting
+// spans. Head sampling should keep everything the tail sampler needs to see.
+func NewTailSampler(cfg config.TailSamplingConfig, processor sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	if err := validRatio(cfg.Ratio); err != nil {
+		return nil, err
+	}
+
+	p := &tailSampler{
+		SpanProcessor: processor,
+		cfg:           cfg,
+		ratio:         sdktrace.TraceIDRatioBased(cfg.Ratio),
+		traces:        map[trace.TraceID]*tailTrace{},
+		order:         list.New(),
+		decided:       map[trace.TraceID]*decision{},
+		decisions:     list.New(),
+		stop:          make(chan struct{}),
+	}
+	for _, rule := range cfg.Rules {
+		if err := validRatio(rule.Ratio); err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, statusRule{rule.Route, rule.Status, sdktrace.TraceIDRatioBased(rule.Ratio)})
+	}
+	return p, nil
+}
@@ -0,0 +1,225 @@
+package srv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func newTailProvider(t *testing.T, cfg config.TailSamplingConfig) (*tailSampler, *sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	processor, err := NewTailSampler(cfg, sdktrace.NewSimpleSpanProcessor(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	return processor.(*tailSampler), tp, exporter
+}
+
+func exportedNames(exporter *tracetest.InMemoryExporter) []string {
+	var names []string
+	for _, s := range exporter.GetSpans() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestTailSpansAfterRoot(t *testing.T) {
+	tests := map[string]struct {
+		ratio float64
+		want  int
+	}{
+		"kept":    {ratio: 1, want: 2},
+		"dropped": {ratio: 0, want: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, tp, exporter := newTailProvider(t, config.TailSamplingConfig{Ratio: tt.ratio, DecisionWait: time.Minute})
+			tracer := tp.Tracer("test")
+
+			ctx, root := tracer.Start(context.Background(), "root")
+			_, child := tracer.Start(ctx, "async")
+			root.End()
+			child.End()
+
+			if got := exportedNames(exporter); len(got) != tt.want {
+				t.Errorf("exported %v, want %d spans", got, tt.want)
+			}
+			p.mu.Lock()
+			buffered := len(p.traces)
+			p.mu.Unlock()
+			if buffered != 0 {
+				t.Errorf("%d traces left buffered", buffered)
+			}
+		})
+	}
+}
+
+func TestTailEvictsWithoutRoot(t *testing.T) {
+	p, tp, exporter := newTailProvider(t, config.TailSamplingConfig{Ratio: 1, DecisionWait: time.Minute})
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+
+	p.evict(time.Now())
+	if got := exportedNames(exporter); len(got) != 0 {
+		t.Fatalf("exported %v before the wait", got)
+	}
+	p.evict(time.Now().Add(2 * time.Minute))
+	if got := exportedNames(exporter); len(got) != 1 || got[0] != "child" {
+		t.Fatalf("exported %v, want the child", got)
+	}
+
+	// the root ending late follows the trace.
+	root.End()
+	if got := exportedNames(exporter); len(got) != 2 {
+		t.Errorf("exported %v, want the late root too", got)
+	}
+
+	// decisions are forgotten after a while.
+	p.evict(time.Now().Add(time.Hour))
+	p.mu.Lock()
+	decided := len(p.decided)
+	p.mu.Unlock()
+	if decided != 0 {
+		t.Errorf("%d decisions remembered", decided)
+	}
+}
+
+func TestTailStartStops(t *testing.T) {
+	p, _, _ := newTailProvider(t, config.TailSamplingConfig{Ratio: 1, DecisionWait: time.Minute})
+
+	done := make(chan error, 1)
+	go func() { done <- p.Start(context.Background()) }()
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start still running after Shutdown")
+	}
+}
+
+func TestTailKeepsAtRatioZero(t *testing.T) {
+	start := time.Now()
+	tests := map[string]struct {
+		cfg  config.TailSamplingConfig
+		run  func(tracer trace.Tracer)
+		want []string
+	}{
+		"errored": {
+			run: func(tracer trace.Tracer) {
+				ctx, root := tracer.Start(context.Background(), "root")
+				_, child := tracer.Start(ctx, "child")
+				child.SetStatus(codes.Error, "failed")
+				child.End()
+				root.End()
+			},
+			want: []string{"child", "root"},
+		},
+		"slow": {
+			cfg: config.TailSamplingConfig{Latency: time.Second},
+			run: func(tracer trace.Tracer) {
+				_, root := tracer.Start(context.Background(), "root", trace.WithTimestamp(start))
+				root.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+			},
+			want: []string{"root"},
+		},
+		"errored and pushed out": {
+			cfg: config.TailSamplingConfig{MaxTraces: 1},
+			run: func(tracer trace.Tracer) {
+				// neither root ends.
+				ctx, _ := tracer.Start(context.Background(), "root")
+				_, child := tracer.Start(ctx, "child")
+				child.SetStatus(codes.Error, "failed")
+				child.End()
+
+				// the next trace takes the only place in the buffer.
+				ctx, _ = tracer.Start(context.Background(), "other")
+				_, other := tracer.Start(ctx, "other-child")
+				other.End()
+			},
+			want: []string{"child"},
+		},
+		"fast and fine": {
+			cfg: config.TailSamplingConfig{Latency: time.Hour},
+			run: func(tracer trace.Tracer) {
+				_, root := tracer.Start(context.Background(), "root")
+				root.End()
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, tp, exporter := newTailProvider(t, tt.cfg)
+			tt.run(tp.Tracer("test"))
+
+			got := exportedNames(exporter)
+			if len(got) != len(tt.want) {
+				t.Fatalf("exported %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("exported %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTailWaitsByDefault(t *testing.T) {
+	p, tp, exporter := newTailProvider(t, config.TailSamplingConfig{Ratio: 1})
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	defer root.End()
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+
+	p.evict(time.Now().Add(defaultDecisionWait / 2))
+	if got := exportedNames(exporter); len(got) != 0 {
+		t.Fatalf("exported %v before the wait", got)
+	}
+	p.evict(time.Now().Add(defaultDecisionWait))
+	if got := exportedNames(exporter); len(got) != 1 {
+		t.Errorf("exported %v, want the child after the default wait", got)
+	}
+}
+
+func TestTailForgetsPastMaxTraces(t *testing.T) {
+	p, tp, _ := newTailProvider(t, config.TailSamplingConfig{MaxTraces: 2, DecisionWait: time.Hour})
+	tracer := tp.Tracer("test")
+
+	var roots []trace.SpanContext
+	for i := 0; i < 3; i++ {
+		_, root := tracer.Start(context.Background(), "root")
+		root.End()
+		roots = append(roots, root.SpanContext())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.decided) != 2 {
+		t.Fatalf("%d decisions remembered, want 2", len(p.decided))
+	}
+	if _, ok := p.decided[roots[0].TraceID()]; ok {
+		t.Error("the oldest decision is still remembered")
+	}
+}
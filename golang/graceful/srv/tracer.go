@@ -0,0 +1,156 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+type tracer struct {
+	tp *trace.TracerProvider
+	// tail evicts the traces it buffers while the tracer runs.
+	tail Startable
+}
+
+func (t *tracer) Start(ctx context.Context) error {
+	if t.tail != nil {
+		return t.tail.Start(ctx)
+	}
+	return nil
+}
+
+func (t *tracer) Shutdown(ctx context.Context) error {
+	t.tp.ForceFlush(ctx)
+	return t.tp.Shutdown(ctx)
+}
+
+func newTracer(exporter trace.SpanExporter, cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	processor := trace.NewBatchSpanProcessor(exporter)
+	var tail Startable
+	if cfg.Tail.Enabled {
+		tailProcessor, err := NewTailSampler(cfg.Tail, processor)
+		if err != nil {
+			return nil, err
+		}
+		processor = tailProcessor
+		tail, _ = tailProcessor.(Startable)
+	}
+
+	sampler, processor, err := NewSampler(cfg.Sampling, processor)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(sampler),
+		trace.WithSpanProcessor(processor),
+		trace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return &tracer{
+		tp:   tp,
+		tail: tail,
+	}, nil
+}
+
+// ProjectId works out the GCP project from the config, the environment or
+// the account the gcp detector found. It doesn't call out, so the handler
+// resolves it once into the config for the exporter and access log. An
+// empty result leaves it to the exporter to find from the credentials.
+func ProjectId(cfg *config.Config, res *resource.Resource) string {
+	if cfg.Tracing.ProjectId != "" {
+		return cfg.Tracing.ProjectId
+	}
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		return project
+	}
+
+	var provider, account string
+	for _, kv := range res.Attributes() {
+		switch kv.Key {
+		case semconv.CloudProviderKey:
+			provider = kv.Value.AsString()
+		case semconv.CloudAccountIDKey:
+			account = kv.Value.AsString()
+		}
+	}
+	if provider != semconv.CloudProviderGCP.Value.AsString() {
+		return ""
+	}
+	return account
+}
+
+func NewGcpTracer(cfg config.TracingConfig, projectId string, res *resource.Resource) (Startable, error) {
+	opts := []texporter.Option{}
+	if projectId != "" {
+		opts = append(opts, texporter.WithProjectID(projectId))
+	}
+
+	exporter, err := texporter.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, cfg, res)
+}
+
+func NewZipkin(cfg config.TracingConfig, res *resource.Resource) (Startable, error) {
+	exporter, err := zipkin.New(cfg.Url)
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(exporter, cfg, res)
+}
+
+// withBaggage makes sure configured baggage members are propagated.
+func withBaggage(propagators []string, members []string) []string {
+	if len(members) == 0 {
+		return propagators
+	}
+	for _, name := range propagators {
+		if strings.EqualFold(strings.TrimSpace(name), "baggage") {
+			return propagators
+		}
+	}
+	return append(append([]string{}, propagators...), "baggage")
+}
+
+func NewTracer(ctx context.Context, cfg *config.Config, res *resource.Resource) (Startable, error) {
+	// propagate even when not tracing so downstream calls keep the trace.
+	propagator, err := NewPropagator(withBaggage(cfg.Tracing.Propagators, cfg.Baggage.Members))
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	if !cfg.Tracing.Enabled {
+		return NewNoop(), nil
+	}
+
+	switch cfg.Tracing.Type {
+	case "zipkin":
+		return NewZipkin(cfg.Tracing, res)
+	case "gcp":
+		return NewGcpTracer(cfg.Tracing, ProjectId(cfg, res), res)
+	case "otlp-grpc":
+		return NewOtlpGrpcTracer(ctx, cfg.Tracing, res)
+	case "otlp-http":
+		return NewOtlpHttpTracer(ctx, cfg.Tracing, res)
+	case "stdout":
+		return NewStdoutTracer(cfg.Tracing, res)
+	case "file":
+		return NewFileTracer(cfg.Tracing, res)
+	default:
+		return nil, fmt.Errorf("unknown tracing type: %q", cfg.Tracing.Type)
+	}
+}
@@ -0,0 +1,37 @@
+package srv
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// WithTracing starts a server span for every request, named by its route,
+// continuing the trace of the caller when the headers carry one. The span
+// is in the request context handed to the function.
+func WithTracing(cfg *config.Config, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := RouteFromContext(r.Context())
+		opts := []trace.SpanStartOption{
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+			trace.WithAttributes(semconv.EndUserAttributesFromHTTPRequest(r)...),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(cfg.ServiceName, route, r)...),
+		}
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, r.Method+" "+route, opts...)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sw.status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(sw.status, trace.SpanKindServer))
+	})
+}
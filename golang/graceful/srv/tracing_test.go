@@ -0,0 +1,88 @@
+package srv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+func TestHandlerSpansByRoute(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if route := RouteFromContext(r.Context()); route != "/users/" {
+			t.Errorf("route in the function = %q", route)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	cfg := &config.Config{
+		ServiceName: "test",
+		Metrics:     config.MetricsConfig{MaxRoutes: 10},
+		Tracing:     config.TracingConfig{Enabled: true},
+	}
+	h, err := newHandler(cfg, mux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /users/" {
+		t.Errorf("span name = %q, want %q", span.Name, "GET /users/")
+	}
+	var route string
+	for _, kv := range span.Attributes {
+		if kv.Key == semconv.HTTPRouteKey {
+			route = kv.Value.AsString()
+		}
+	}
+	if route != "/users/" {
+		t.Errorf("http.route = %q", route)
+	}
+
+	// the latency points at the server span.
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exemplar *dto.Exemplar
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				if bucket.GetExemplar() != nil {
+					exemplar = bucket.GetExemplar()
+				}
+			}
+		}
+	}
+	if exemplar == nil {
+		t.Fatal("no exemplar recorded")
+	}
+	for _, pair := range exemplar.GetLabel() {
+		if pair.GetName() == "trace_id" && pair.GetValue() != span.SpanContext.TraceID().String() {
+			t.Errorf("exemplar trace_id = %s, want %s", pair.GetValue(), span.SpanContext.TraceID())
+		}
+	}
+}
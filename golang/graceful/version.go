@@ -0,0 +1,101 @@
+package graceful
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/contextcloud/graceful/config"
+)
+
+// GitCommit inject by -ldflags
+// GIT_COMMIT=git rev-list -1 HEAD && go build -ldflags "-X github.com/contextcloud/graceful.GitCommit=$GIT_COMMIT"
+var GitCommit string
+
+// Version of module from go.mod
+var Version string
+
+// BuildDate time of build
+var BuildDate string
+
+func init() {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	// ldflags win, the embedded build info fills in whatever they left out.
+	if Version == "" && bi.Main.Version != "(devel)" {
+		Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if GitCommit == "" {
+				GitCommit = s.Value
+			}
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = s.Value
+			}
+		}
+	}
+}
+
+type BuildInfo struct {
+	Version   string `json:"version,omitempty"`
+	GitCommit string `json:"gitCommit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Build returns the information injected when the binary was built.
+func Build() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// RegisterBuildInfo exposes a build_info gauge which is always 1 and carries
+// the build as labels.
+func RegisterBuildInfo() error {
+	build := Build()
+
+	return prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Build information of the running binary.",
+		ConstLabels: prometheus.Labels{
+			"version":    build.Version,
+			"revision":   build.GitCommit,
+			"build_date": build.BuildDate,
+			"goversion":  build.GoVersion,
+		},
+	}, func() float64 { return 1 }))
+}
+
+type versionResponse struct {
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	BuildInfo
+}
+
+// VersionHandler answers with the service and the build it is running.
+func VersionHandler(cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		encoder.Encode(versionResponse{
+			Service:     cfg.ServiceName,
+			Environment: cfg.Environment,
+			BuildInfo:   Build(),
+		})
+	})
+}
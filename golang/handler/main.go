@@ -2,47 +2,158 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"function"
 
+	"go.uber.org/zap"
+
 	"github.com/contextcloud/graceful"
 	"github.com/contextcloud/graceful/config"
+	"github.com/contextcloud/graceful/httpclient"
+	"github.com/contextcloud/graceful/limits"
+	"github.com/contextcloud/graceful/logging"
+	"github.com/contextcloud/graceful/metrics"
+	"github.com/contextcloud/graceful/platform"
+	"github.com/contextcloud/graceful/slo"
 	"github.com/contextcloud/graceful/srv"
 )
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
+	startup := srv.NewStartup()
 
+	done := startup.Phase("config")
 	cfg, err := config.NewConfig(ctx)
 	if err != nil {
 		panic(err)
 	}
+	done()
 
-	handler, err := function.NewHandler(ctx, cfg)
+	// everything logs through one structured logger, including log.Print.
+	logger, levels, err := logging.New(cfg)
 	if err != nil {
 		panic(err)
 	}
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+	zap.RedirectStdLog(logger)
+	ctx = logging.WithLogger(ctx, logger)
+
+	// exit through here so buffered log entries are flushed.
+	if err := run(ctx, cfg, startup, levels); err != nil {
+		logger.Error("exiting", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+	cancel()
 
-	startable, err := srv.NewStartable(cfg.SrvAddr, handler)
+	<-ctx.Done()
+}
+
+// run serves the function until the process is told to stop.
+func run(ctx context.Context, cfg *config.Config, startup *srv.Startup, levels *logging.Levels) error {
+	logger := logging.FromContext(ctx)
+
+	// size the runtime to the container before the function allocates.
+	runtimeLimits, err := limits.Apply(cfg.Runtime, os.DirFS("/"))
 	if err != nil {
-		panic(err)
+		logger.Warn("runtime limits", zap.Error(err))
 	}
 
-	tracer, err := srv.NewTracer(ctx, cfg)
+	if err := graceful.RegisterBuildInfo(); err != nil {
+		return fmt.Errorf("register build info: %w", err)
+	}
+
+	// functions register their own metrics through the context.
+	registry := metrics.NewRegistry(cfg)
+	ctx = metrics.WithRegistry(ctx, registry)
+	gatherer := metrics.NewGatherer(cfg, registry)
+
+	// functions call other services through the instrumented clients.
+	clients := httpclient.NewFactory(cfg.Client)
+	ctx = httpclient.WithFactory(ctx, clients)
+
+	done := startup.Phase("handler")
+	handler, err := function.NewHandler(ctx, cfg)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("create handler: %w", err)
 	}
+	done()
 
-	multi := srv.NewMulti(
-		tracer,
-		srv.NewMetricsServer(cfg.MetricsAddr),
-		srv.NewHealth(cfg.HealthAddr),
-		startable,
+	// the meter and the tracer describe the service the same way.
+	done = startup.Phase("resource")
+	res, err := srv.NewResource(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create resource: %w", err)
+	}
+	// resolve the GCP project once for everything reporting to Google Cloud.
+	cfg.Tracing.ProjectId = srv.ProjectId(cfg, res)
+	done()
+
+	done = startup.Phase("meter")
+	meter, err := srv.NewMeter(ctx, cfg, res, registry)
+	if err != nil {
+		return fmt.Errorf("create meter: %w", err)
+	}
+	done()
+
+	objectives, err := slo.NewTracker(cfg.SLO)
+	if err != nil {
+		return fmt.Errorf("create slo tracker: %w", err)
+	}
+
+	startable, err := srv.NewStartable(cfg, handler, meter, objectives)
+	if err != nil {
+		return fmt.Errorf("create server: %w", err)
+	}
+
+	done = startup.Phase("tracer")
+	tracer, err := srv.NewTracer(ctx, cfg, res)
+	if err != nil {
+		return fmt.Errorf("create tracer: %w", err)
+	}
+	done()
+
+	// log levels can be changed at runtime through the admin port.
+	admin, err := srv.NewAdmin(cfg, levels)
+	if err != nil {
+		return fmt.Errorf("create admin server: %w", err)
+	}
+
+	health := srv.NewHealth(cfg)
+	health.AddInfo("build", graceful.Build())
+	health.AddInfo("runtime", runtimeLimits)
+	health.AddInfo("platform", platform.Detect())
+	health.AddInfo("startup", startup.Phases)
+	health.AddInfo("slo", func() interface{} { return objectives.Report() })
+	health.Handle("/version", graceful.VersionHandler(cfg))
+
+	// the tracer is installed now so the startup span can be exported.
+	startup.Report(ctx)
+
+	// stop taking traffic before anything else goes away.
+	multi := srv.NewDrain(health, cfg.ShutdownDelay,
+		srv.Phase{Name: "server", Service: startable},
+		srv.Phase{Name: "tracer", Service: tracer},
+		srv.Phase{Name: "meter", Service: meter},
+		srv.Phase{Name: "pushgateway", Service: srv.NewPushgateway(cfg, gatherer)},
+		srv.Phase{Name: "metrics", Service: srv.NewMetricsServer(cfg.MetricsAddr, gatherer)},
+		srv.Phase{Name: "admin", Service: admin},
+		srv.Phase{Name: "health", Service: health},
+	)
+
+	logger.Info("starting",
+		zap.String("addr", cfg.SrvAddr),
+		zap.String("metrics_addr", cfg.MetricsAddr),
+		zap.String("health_addr", cfg.HealthAddr),
+		zap.String("admin_addr", cfg.Admin.Addr),
 	)
 
 	// graceful?
 	graceful.Run(ctx, multi)
-	cancel()
-
-	<-ctx.Done()
+	clients.CloseIdleConnections()
+	httpclient.CloseIdleConnections()
+	return nil
 }